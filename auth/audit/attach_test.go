@@ -0,0 +1,119 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	realms2 "github.com/universe-10th/identity/realms"
+)
+
+// A buffer safe for concurrent use.
+type syncBuffer struct {
+	mutex  sync.Mutex
+	buffer bytes.Buffer
+}
+
+func (buffer *syncBuffer) Write(data []byte) (int, error) {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	return buffer.buffer.Write(data)
+}
+
+// Decodes all the written records.
+func (buffer *syncBuffer) records(t *testing.T) []Record {
+	buffer.mutex.Lock()
+	defer buffer.mutex.Unlock()
+	var records []Record
+	for _, line := range strings.Split(strings.TrimSpace(buffer.buffer.String()), "\n") {
+		var record Record
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// Creates a protocol with a single "main" realm having
+// the sample credentials.
+func newTestProtocol(options ...auth.AuthOption) *auth.AuthProtocol {
+	return auth.NewAuthProtocol(map[string]*realms2.Realm{"main": harness.NewRealm()}, options...)
+}
+
+// Invokes a command of the protocol.
+func invoke(t *testing.T, protocol *auth.AuthProtocol, server *chasqui.Server, attendant *chasqui.Attendant, command string, args ...interface{}) {
+	harness.Invoke(t, protocol.Handlers(), server, attendant, "auth."+command, args...)
+}
+
+func TestAsyncWritesCaptureTheSessionWhenTheEventFires(t *testing.T) {
+	protocol := newTestProtocol()
+	buffer := &syncBuffer{}
+	auditor := NewAuditor(buffer, WithAsyncWrites(8, events.Block))
+	defer auditor.Attach(protocol)()
+	server := harness.NewServer()
+	attendant := harness.NewAttendant(t)
+
+	invoke(t, protocol, server, attendant, "login", "alice", "alice1", "main")
+	sessionID := protocol.Session(attendant).ID()
+	invoke(t, protocol, server, attendant, "logout")
+	auditor.Close()
+
+	records := buffer.records(t)
+	if len(records) != 2 || records[1].Event != "logout" {
+		t.Fatalf("unexpected records: %+v", records)
+	}
+	if records[1].SessionID != sessionID || records[1].RealmKey != "main" {
+		t.Fatalf("the logout record must have the removed session: %+v", records[1])
+	}
+	if records[1].Timestamp.Before(records[0].Timestamp) {
+		t.Fatal("the records must be timestamped in order")
+	}
+}
+
+func TestRejectedLoginIsASingleRecord(t *testing.T) {
+	protocol := newTestProtocol()
+	buffer := &syncBuffer{}
+	defer NewAuditor(buffer).Attach(protocol)()
+	server := harness.NewServer()
+
+	invoke(t, protocol, server, harness.NewAttendant(t), "login", "alice", "alice1", "main")
+	invoke(t, protocol, server, harness.NewAttendant(t), "login", "alice", "alice1", "main")
+
+	records := buffer.records(t)
+	if len(records) != 2 {
+		t.Fatalf("expected one record per login, got %+v", records)
+	}
+	if records[1].Event != "login" || records[1].ErrorCode != "rejected" {
+		t.Fatalf("unexpected rejection record: %+v", records[1])
+	}
+}
+
+func TestGhostedRecordHasTheGhostedSession(t *testing.T) {
+	protocol := newTestProtocol(auth.WithSingleGhostingDomain)
+	buffer := &syncBuffer{}
+	defer NewAuditor(buffer).Attach(protocol)()
+	server, previous, next := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+
+	invoke(t, protocol, server, previous, "login", "alice", "alice1", "main")
+	ghosted := protocol.Session(previous)
+	invoke(t, protocol, server, next, "login", "alice", "alice1", "main")
+
+	for _, record := range buffer.records(t) {
+		if record.Event != "ghosted" {
+			continue
+		}
+		if record.Identifier != "alice" || record.SessionID != ghosted.ID() ||
+			record.RealmKey != "main" || record.RemoteAddress != ghosted.RemoteAddress() {
+			t.Fatalf("the ghosted record must have the ghosted session: %+v", record)
+		}
+		return
+	}
+	t.Fatal("expected a ghosted record")
+}
@@ -0,0 +1,350 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/policy"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+	"github.com/universe-10th/identity/credentials/traits/identified"
+	"github.com/universe-10th/identity/credentials/traits/indexed"
+	"github.com/universe-10th/identity/realms"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Returned by Verify when a record does not match its MAC.
+var ErrTampered = errors.New("audit record does not match its mac")
+
+// This type represents an option to the NewAuditor()
+// builder.
+type AuditorOption func(auditor *Auditor)
+
+// This option-maker returns an option that enables HMAC
+// chaining: each record carries the HMAC (SHA-256, with
+// the given key) of its content and the previous record's
+// HMAC, so removed or altered records can be detected.
+// When writing to a rotating writer, there is one chain
+// per file (so each file can be verified on its own),
+// and it continues across restarts.
+func WithHMACChain(key []byte) AuditorOption {
+	return func(auditor *Auditor) {
+		auditor.key = key
+	}
+}
+
+// This option-maker returns an option that sets the HMAC
+// the chain continues from, for writers other than the
+// rotating one: typically, the HMAC of the last record in
+// the file being appended to. If this option is not used,
+// the chain starts anew.
+func WithPreviousMAC(mac string) AuditorOption {
+	return func(auditor *Auditor) {
+		auditor.lastMAC = mac
+	}
+}
+
+// This option-maker returns an option that makes the
+// auditor write its records asynchronously, through a
+// queue of the given capacity and overflow policy. The
+// records are still captured when the events fire.
+func WithAsyncWrites(capacity int, policy events.OverflowPolicy) AuditorOption {
+	return func(auditor *Auditor) {
+		auditor.queue = events.NewQueue(capacity, policy)
+	}
+}
+
+// This option-maker returns an option that sets the handler
+// of the errors occurring while writing records. If this
+// option is not used, such errors are ignored.
+func WithErrorHandler(handler func(error)) AuditorOption {
+	return func(auditor *Auditor) {
+		auditor.onError = handler
+	}
+}
+
+// An auditor keeps an append-only record of all the
+// authentication activity of auth protocols, writing
+// JSON Lines records to a writer (typically, a rotating
+// writer).
+type Auditor struct {
+	writer  io.Writer
+	key     []byte
+	lastMAC string
+	onError func(error)
+	queue   *events.Queue
+	mutex   sync.Mutex
+}
+
+// A writer of lines which tells the last line of the file
+// each new line will be written to, so the chains can be
+// kept per file. The rotating writer is one of them.
+type lineWriter interface {
+	writeLine(build func(last []byte) ([]byte, error)) error
+}
+
+// Tells the MAC of an encoded record, or "" if it has none.
+func macOf(line []byte) string {
+	var record Record
+	if len(line) == 0 || json.Unmarshal(line, &record) != nil {
+		return ""
+	}
+	return record.MAC
+}
+
+// Computes the chained MAC of an encoded record.
+func chainMAC(key []byte, previous string, encoded []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(previous))
+	mac.Write(encoded)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Encodes a record as a JSON line. If HMAC chaining is
+// enabled, the MAC of the record is computed (chaining the
+// given previous MAC) and added. Returns the line and MAC.
+func (auditor *Auditor) encode(record Record, previous string) ([]byte, string, error) {
+	record.MAC = ""
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return nil, "", err
+	}
+	if auditor.key != nil {
+		record.MAC = chainMAC(auditor.key, previous, encoded)
+		if encoded, err = json.Marshal(record); err != nil {
+			return nil, "", err
+		}
+	}
+	return append(encoded, '\n'), record.MAC, nil
+}
+
+// Writes a record, as a JSON line. If HMAC chaining is
+// enabled, the MAC of the record is computed and added.
+func (auditor *Auditor) Write(record Record) error {
+	auditor.mutex.Lock()
+	defer auditor.mutex.Unlock()
+
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now().UTC()
+	}
+	if writer, ok := auditor.writer.(lineWriter); ok && auditor.key != nil {
+		return writer.writeLine(func(last []byte) ([]byte, error) {
+			line, _, err := auditor.encode(record, macOf(last))
+			return line, err
+		})
+	}
+	line, mac, err := auditor.encode(record, auditor.lastMAC)
+	if err != nil {
+		return err
+	}
+	if _, err = auditor.writer.Write(line); err != nil {
+		return err
+	}
+	auditor.lastMAC = mac
+	return nil
+}
+
+// Writes a record, reporting any error to the handler. The
+// record is timestamped right now, even if it is written
+// asynchronously.
+func (auditor *Auditor) write(record Record) {
+	record.Timestamp = time.Now().UTC()
+	if auditor.queue != nil {
+		auditor.queue.Push(func() {
+			auditor.report(auditor.Write(record))
+		})
+	} else {
+		auditor.report(auditor.Write(record))
+	}
+}
+
+// Reports an error, if any, to the handler.
+func (auditor *Auditor) report(err error) {
+	if err != nil && auditor.onError != nil {
+		auditor.onError(err)
+	}
+}
+
+// Waits until the queued records are written, when writing
+// asynchronously.
+func (auditor *Auditor) Flush() {
+	if auditor.queue != nil {
+		auditor.queue.Flush()
+	}
+}
+
+// Writes the queued records, when writing asynchronously,
+// and stops accepting new ones (which will be dropped).
+func (auditor *Auditor) Close() {
+	if auditor.queue != nil {
+		auditor.queue.Close()
+	}
+}
+
+// Tells a short code for an error, or "" if nil.
+func errorCode(err error) string {
+	switch err {
+	case nil:
+		return ""
+	case realms.ErrLoginFailed:
+		return "login-failed"
+	case auth.ErrRejectedByDomain:
+		return "rejected"
+	case auth.ErrMissingUnifiedKey:
+		return "missing-key"
+	case events.ErrHookPanicked:
+		return "hook-panicked"
+	default:
+		return "error"
+	}
+}
+
+// Tells the outcome of an event, depending on its error.
+func outcome(err error) string {
+	if err != nil {
+		return "failure"
+	}
+	return "success"
+}
+
+// Tells the identification of a credential, if any.
+func identifierOf(credential credentials.Credential) interface{} {
+	if identifiedCredential, ok := credential.(identified.Identified); ok {
+		return identifiedCredential.Identification()
+	} else if indexedCredential, ok := credential.(indexed.Indexed); ok {
+		return indexedCredential.Index()
+	}
+	return nil
+}
+
+// Fills a record with the data of a session, if any.
+func fillSession(record *Record, session *types.Session) {
+	if session != nil {
+		record.SessionID = session.ID()
+		record.RemoteAddress = session.RemoteAddress()
+		record.RealmKey = session.RealmKey()
+		if key := session.Key(); key != nil {
+			record.Identifier = key.Key()
+		}
+	}
+}
+
+// Subscribes the auditor to all the events of an auth
+// protocol. The subscriptions are synchronous, so the
+// records capture the sessions as they are when the
+// events fire (use WithAsyncWrites to write them in
+// the background). A domain rejection is recorded only
+// as a failed login. Returns a function that cancels
+// all the subscriptions.
+func (auditor *Auditor) Attach(protocol *auth.AuthProtocol) func() {
+	subscriptions := []*events.Subscription{
+		protocol.OnLogin().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, identifier interface{}, password, realm string, credential credentials.Credential, err error) {
+			record := Record{Event: "login", RealmKey: realm, Identifier: identifier, Outcome: outcome(err), ErrorCode: errorCode(err)}
+			if err == nil {
+				fillSession(&record, protocol.Session(attendant))
+			}
+			auditor.write(record)
+		}),
+		protocol.OnLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kind events.LogoutKind, reason string, stage events.LogoutStage) {
+			if stage == events.Before {
+				record := Record{Event: "logout", Identifier: identifierOf(credential), Outcome: kind.String(), Detail: reason}
+				fillSession(&record, protocol.Session(attendant))
+				auditor.write(record)
+			}
+		}),
+		protocol.OnPasswordChange().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, err error) {
+			record := Record{Event: "password-change", Identifier: identifierOf(credential), Outcome: outcome(err), ErrorCode: errorCode(err)}
+			fillSession(&record, protocol.Session(attendant))
+			auditor.write(record)
+		}),
+		protocol.OnPasswordChangeLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kicked []*chasqui.Attendant) {
+			record := Record{Event: "password-change-logout", Identifier: identifierOf(credential), Outcome: "success", Detail: strconv.Itoa(len(kicked))}
+			fillSession(&record, protocol.Session(attendant))
+			auditor.write(record)
+		}),
+		protocol.OnResume().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, session *types.Session) {
+			record := Record{Event: "resume", Outcome: "success"}
+			fillSession(&record, session)
+			auditor.write(record)
+		}),
+		protocol.OnGhosted().Register(func(server *chasqui.Server, ghosted, by *chasqui.Attendant, credential credentials.Credential, session *types.Session) {
+			record := Record{Event: "ghosted", Identifier: identifierOf(credential), Outcome: "success"}
+			fillSession(&record, session)
+			auditor.write(record)
+		}),
+		protocol.OnAuthorizationDenied().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, requirement authreqs.AuthorizationRequirement, command string) {
+			record := Record{Event: "authorization-denied", Identifier: identifierOf(credential), Outcome: "denied", Detail: command}
+			if denial, ok := requirement.(*policy.Denial); ok {
+				record.ErrorCode = "policy-denied"
+				record.Detail = command + " (rule: " + denial.Rule.Name + ")"
+			}
+			fillSession(&record, protocol.Session(attendant))
+			auditor.write(record)
+		}),
+		protocol.OnNotLoggedIn().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, command string) {
+			auditor.write(Record{Event: "not-logged-in", Outcome: "denied", Detail: command})
+		}),
+		protocol.OnSessionExpired().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, session *types.Session) {
+			record := Record{Event: "session-expired", Outcome: "success"}
+			fillSession(&record, session)
+			auditor.write(record)
+		}),
+	}
+	return func() {
+		for _, subscription := range subscriptions {
+			subscription.Cancel()
+		}
+	}
+}
+
+// Verifies the HMAC chain of the records read from a reader,
+// with the given key. Each file of a rotating writer has its
+// own chain, so the files must be verified one by one. Returns ErrTampered (wrapped, with the
+// line number) on the first record not matching its MAC.
+func Verify(reader io.Reader, key []byte) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	previous := ""
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := scanner.Bytes()
+		var record Record
+		if err := json.Unmarshal(raw, &record); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		// The MAC is the last field, so the MAC'd content is
+		// the line without it. This avoids re-encoding values.
+		suffix := []byte(`,"mac":"` + record.MAC + `"}`)
+		if record.MAC == "" || !bytes.HasSuffix(raw, suffix) {
+			return fmt.Errorf("line %d: %w", line, ErrTampered)
+		}
+		encoded := append(append([]byte{}, raw[:len(raw)-len(suffix)]...), '}')
+		if !hmac.Equal([]byte(chainMAC(key, previous, encoded)), []byte(record.MAC)) {
+			return fmt.Errorf("line %d: %w", line, ErrTampered)
+		}
+		previous = record.MAC
+	}
+	return scanner.Err()
+}
+
+// Creates a new auditor writing to the given writer.
+func NewAuditor(writer io.Writer, options ...AuditorOption) *Auditor {
+	auditor := &Auditor{writer: writer}
+	for _, option := range options {
+		option(auditor)
+	}
+	return auditor
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testKey = []byte("secret")
+
+// Creates a temporary directory, removed after the test.
+func tempDir(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(directory)
+	})
+	return directory
+}
+
+// Creates a rotating writer for the given path.
+func newTestWriter(t *testing.T, path string, maxSize int64) *RotatingWriter {
+	writer, err := NewRotatingWriter(path, maxSize, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writer
+}
+
+// Verifies a file, failing the test on error.
+func verifyFile(t *testing.T, path string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(bytes.NewReader(content), testKey); err != nil {
+		t.Fatalf("%s: %v", filepath.Base(path), err)
+	}
+}
+
+func TestChainDetectsTampering(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	auditor := NewAuditor(buffer, WithHMACChain(testKey))
+	for _, event := range []string{"login", "logout", "login"} {
+		if err := auditor.Write(Record{Event: event, Identifier: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Verify(bytes.NewReader(buffer.Bytes()), testKey); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.SplitAfter(buffer.String(), "\n")
+	if err := Verify(strings.NewReader(lines[0]+lines[2]), testKey); !errors.Is(err, ErrTampered) {
+		t.Fatalf("a removed record must be detected, got %v", err)
+	}
+	altered := strings.Replace(buffer.String(), "alice", "bob", 1)
+	if err := Verify(strings.NewReader(altered), testKey); !errors.Is(err, ErrTampered) {
+		t.Fatalf("an altered record must be detected, got %v", err)
+	}
+}
+
+func TestChainContinuesAcrossRestarts(t *testing.T) {
+	path := filepath.Join(tempDir(t), "audit.log")
+	for restart := 0; restart < 3; restart++ {
+		writer := newTestWriter(t, path, 0)
+		auditor := NewAuditor(writer, WithHMACChain(testKey))
+		for index := 0; index < 2; index++ {
+			if err := auditor.Write(Record{Event: "login"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := writer.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	verifyFile(t, path)
+}
+
+func TestChainStartsAnewInEachRotatedFile(t *testing.T) {
+	directory := tempDir(t)
+	path := filepath.Join(directory, "audit.log")
+	writer := newTestWriter(t, path, 400)
+	auditor := NewAuditor(writer, WithHMACChain(testKey))
+	for index := 0; index < 10; index++ {
+		if err := auditor.Write(Record{Event: "login", Identifier: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+		// Rotated names have a nanosecond timestamp.
+		time.Sleep(time.Millisecond)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(path + "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) < 3 {
+		t.Fatalf("expected several rotated files, got %v", files)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		verifyFile(t, file)
+	}
+}
+
+func TestRotatingWriterRemembersTheLastLine(t *testing.T) {
+	path := filepath.Join(tempDir(t), "audit.log")
+	if err := ioutil.WriteFile(path, []byte("first\nsecond\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	writer := newTestWriter(t, path, 0)
+	defer writer.Close()
+	if string(writer.last) != "second" {
+		t.Fatalf("unexpected last line: %q", writer.last)
+	}
+	if _, err := writer.Write([]byte("third\nfourth\n")); err != nil {
+		t.Fatal(err)
+	}
+	if string(writer.last) != "fourth" {
+		t.Fatalf("unexpected last line: %q", writer.last)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotatingWriterKeepsTheAgeAcrossRestarts(t *testing.T) {
+	path := filepath.Join(tempDir(t), "audit.log")
+	writer, err := NewRotatingWriter(path, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	started := writer.opened
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+
+	writer, err = NewRotatingWriter(path, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	if !writer.opened.Equal(started) {
+		t.Fatalf("the file was started at %v, but the restarted writer tells %v", started, writer.opened)
+	}
+}
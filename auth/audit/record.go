@@ -0,0 +1,32 @@
+package audit
+
+import "time"
+
+// A single audit record, written as one JSON line. Not
+// all the fields apply to all the events: empty fields
+// are omitted.
+type Record struct {
+	// The moment the event was recorded.
+	Timestamp time.Time `json:"timestamp"`
+	// The name of the event (e.g. "login", "logout").
+	Event string `json:"event"`
+	// The key of the involved realm.
+	RealmKey string `json:"realm_key,omitempty"`
+	// The identifier of the involved credential.
+	Identifier interface{} `json:"identifier,omitempty"`
+	// The id of the involved session.
+	SessionID string `json:"session_id,omitempty"`
+	// The remote address of the involved session.
+	RemoteAddress string `json:"remote_address,omitempty"`
+	// The outcome of the event (e.g. "success", "failure",
+	// "denied", or the kind of a logout).
+	Outcome string `json:"outcome,omitempty"`
+	// A short code for the error, if any.
+	ErrorCode string `json:"error_code,omitempty"`
+	// Extra detail (e.g. the command, or the reason of a
+	// logout).
+	Detail string `json:"detail,omitempty"`
+	// The HMAC of this record, chained with the HMAC of the
+	// previous record, when chaining is enabled.
+	MAC string `json:"mac,omitempty"`
+}
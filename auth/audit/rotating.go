@@ -0,0 +1,213 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A rotating file writer. Records are appended to a single
+// file until it grows beyond a maximum size or gets older
+// than a maximum age. Then, the file is renamed (adding a
+// timestamp suffix) and a new file is started. When there
+// is a maximum age, the time the current file was started
+// is kept in a file next to it (with a .created suffix),
+// so the age is kept across restarts.
+type RotatingWriter struct {
+	path    string
+	maxSize int64
+	maxAge  time.Duration
+	file    *os.File
+	size    int64
+	opened  time.Time
+	// The last line in the current file (nil if empty),
+	// so auditors can chain their records per file.
+	last  []byte
+	mutex sync.Mutex
+}
+
+// Reads the last non-empty line of a file.
+func lastLine(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var last []byte
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	return last, scanner.Err()
+}
+
+// The path of the file keeping the time the current file
+// was started.
+func (writer *RotatingWriter) startedPath() string {
+	return writer.path + ".created"
+}
+
+// Tells when the current file, having the given size, was
+// started. Empty files, and files whose start time was not
+// kept, are started now, and that time is kept.
+func (writer *RotatingWriter) started(size int64) (time.Time, error) {
+	if writer.maxAge <= 0 {
+		return time.Now(), nil
+	}
+	if size > 0 {
+		if content, err := ioutil.ReadFile(writer.startedPath()); err == nil {
+			if started, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(content))); err == nil {
+				return started, nil
+			}
+		}
+	}
+	now := time.Now()
+	return now, ioutil.WriteFile(writer.startedPath(), []byte(now.UTC().Format(time.RFC3339Nano)), 0600)
+}
+
+// Keeps the last line of the given, just written, bytes.
+func (writer *RotatingWriter) remember(data []byte) {
+	data = bytes.TrimRight(data, "\n")
+	if index := bytes.LastIndexByte(data, '\n'); index >= 0 {
+		data = data[index+1:]
+	}
+	if len(data) > 0 {
+		writer.last = append([]byte{}, data...)
+	}
+}
+
+// Opens (creating or appending) the current file, and
+// reads its last line and the time it was started.
+func (writer *RotatingWriter) open() error {
+	if file, err := os.OpenFile(writer.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600); err != nil {
+		return err
+	} else if info, err := file.Stat(); err != nil {
+		_ = file.Close()
+		return err
+	} else if last, err := lastLine(writer.path); err != nil {
+		_ = file.Close()
+		return err
+	} else if started, err := writer.started(info.Size()); err != nil {
+		_ = file.Close()
+		return err
+	} else {
+		writer.file = file
+		writer.size = info.Size()
+		writer.opened = started
+		writer.last = last
+		return nil
+	}
+}
+
+// Closes the current file, renames it and opens a new one.
+func (writer *RotatingWriter) rotate() error {
+	if err := writer.file.Close(); err != nil {
+		return err
+	}
+	writer.file = nil
+	rotated := fmt.Sprintf("%s.%s", writer.path, time.Now().UTC().Format("20060102T150405.000000000"))
+	if err := os.Rename(writer.path, rotated); err != nil {
+		return err
+	}
+	return writer.open()
+}
+
+// Tells whether writing the given number of bytes requires
+// rotating the current file first. Empty files are never
+// rotated.
+func (writer *RotatingWriter) mustRotate(length int) bool {
+	if writer.size == 0 {
+		return false
+	}
+	if writer.maxSize > 0 && writer.size+int64(length) > writer.maxSize {
+		return true
+	}
+	return writer.maxAge > 0 && time.Since(writer.opened) >= writer.maxAge
+}
+
+// Writes the given bytes in the current file, rotating it
+// beforehand if needed. Bytes given in a single call are
+// never split among files.
+func (writer *RotatingWriter) Write(data []byte) (int, error) {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.file == nil {
+		return 0, os.ErrClosed
+	}
+	if writer.mustRotate(len(data)) {
+		if err := writer.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	written, err := writer.file.Write(data)
+	writer.size += int64(written)
+	if err == nil {
+		writer.remember(data)
+	}
+	return written, err
+}
+
+// Writes the line built by the given function, which
+// receives the last line of the file the new one will be
+// written to (nil if that file is empty). The current file
+// is rotated beforehand if needed, and then the line is
+// built again for the new file.
+func (writer *RotatingWriter) writeLine(build func(last []byte) ([]byte, error)) error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.file == nil {
+		return os.ErrClosed
+	}
+	data, err := build(writer.last)
+	if err != nil {
+		return err
+	}
+	if writer.mustRotate(len(data)) {
+		if err = writer.rotate(); err != nil {
+			return err
+		}
+		if data, err = build(writer.last); err != nil {
+			return err
+		}
+	}
+	written, err := writer.file.Write(data)
+	writer.size += int64(written)
+	if err == nil {
+		writer.remember(data)
+	}
+	return err
+}
+
+// Closes the current file. Further writes will fail.
+func (writer *RotatingWriter) Close() error {
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+
+	if writer.file == nil {
+		return os.ErrClosed
+	}
+	err := writer.file.Close()
+	writer.file = nil
+	return err
+}
+
+// Creates a rotating writer for the given path. A maximum
+// size (in bytes) and a maximum age may be given: zero
+// values disable the respective rotation criterion.
+func NewRotatingWriter(path string, maxSize int64, maxAge time.Duration) (*RotatingWriter, error) {
+	writer := &RotatingWriter{path: path, maxSize: maxSize, maxAge: maxAge}
+	if err := writer.open(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
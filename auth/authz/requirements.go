@@ -0,0 +1,329 @@
+package authz
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A realm-aware requirement is also tested against
+// the key of the realm the credential logged in
+// through. Protocols wrapping handlers will detect
+// these requirements and provide the realm key of
+// the current session.
+type RealmAwareRequirement interface {
+	authreqs.AuthorizationRequirement
+	// A mean to test whether a particular credential,
+	// logged in through the given realm, satisfies
+	// this requirement.
+	SatisfiedIn(credential credentials.Credential, realmKey string) bool
+}
+
+// The context a requirement is tested within: the
+// realm key of the session and, when available, the
+// attendant and the message being handled.
+type scope struct {
+	realmKey  string
+	attendant *chasqui.Attendant
+	message   types.Message
+}
+
+// Combinators propagate the whole scope to their
+// children requirements.
+type combinator interface {
+	satisfiedWithin(credential credentials.Credential, within scope) bool
+	children() []authreqs.AuthorizationRequirement
+}
+
+// Tells whether the outcome of a requirement may depend
+// on the message being handled, i.e. whether it is (or
+// combines) a message-aware requirement. Outcomes of
+// other requirements only depend on the credential and
+// its realm, so they can be cached per session.
+func DependsOnMessage(requirement authreqs.AuthorizationRequirement) bool {
+	if combined, ok := requirement.(combinator); ok {
+		for _, child := range combined.children() {
+			if DependsOnMessage(child) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := requirement.(MessageAwareRequirement)
+	return ok
+}
+
+// Tells whether the outcome of a requirement may depend
+// on the realm of the session, i.e. whether it is (or
+// combines) a realm-aware requirement other than the
+// combinators themselves.
+func dependsOnRealm(requirement authreqs.AuthorizationRequirement) bool {
+	if combined, ok := requirement.(combinator); ok {
+		for _, child := range combined.children() {
+			if dependsOnRealm(child) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := requirement.(RealmAwareRequirement)
+	return ok
+}
+
+// Tests a requirement within a scope, using the most
+// informed test the requirement supports.
+func evaluate(requirement authreqs.AuthorizationRequirement, credential credentials.Credential, within scope) bool {
+	if combined, ok := requirement.(combinator); ok {
+		return combined.satisfiedWithin(credential, within)
+	} else if messageAware, ok := requirement.(MessageAwareRequirement); ok && within.message != nil {
+		return messageAware.SatisfiedFor(credential, within.attendant, within.message)
+	} else if realmAware, ok := requirement.(RealmAwareRequirement); ok {
+		return realmAware.SatisfiedIn(credential, within.realmKey)
+	}
+	return requirement.SatisfiedBy(credential)
+}
+
+// Tests a requirement against a credential, also
+// providing the realm key if the requirement is
+// realm-aware.
+func Satisfied(requirement authreqs.AuthorizationRequirement, credential credentials.Credential, realmKey string) bool {
+	return evaluate(requirement, credential, scope{realmKey: realmKey})
+}
+
+// Tests a requirement against a credential, also
+// providing the realm key if the requirement is
+// realm-aware, and the attendant and message if
+// the requirement is message-aware.
+func SatisfiedFor(requirement authreqs.AuthorizationRequirement, credential credentials.Credential, realmKey string,
+	attendant *chasqui.Attendant, message types.Message) bool {
+	return evaluate(requirement, credential, scope{realmKey, attendant, message})
+}
+
+// This requirement checks whether a privileged
+// credential has a given role.
+type RoleRequirement string
+
+// Tests whether the credential has the role.
+func (role RoleRequirement) SatisfiedBy(credential credentials.Credential) bool {
+	if privileged, ok := credential.(Privileged); ok {
+		return privileged.Roles()[string(role)]
+	}
+	return false
+}
+
+// This requirement checks whether a privileged
+// credential has any of the given permissions.
+type AnyPermissionRequirement []string
+
+// Tests whether the credential has any of the permissions.
+func (permissions AnyPermissionRequirement) SatisfiedBy(credential credentials.Credential) bool {
+	if privileged, ok := credential.(Privileged); ok {
+		granted := privileged.Permissions()
+		for _, permission := range permissions {
+			if granted[permission] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// This requirement checks whether the credential
+// logged in through the given realm. It is only
+// satisfied when tested by SatisfiedIn: a bare
+// SatisfiedBy call will always fail.
+type RealmRequirement string
+
+// Always fails, since the realm is unknown.
+func (realm RealmRequirement) SatisfiedBy(credential credentials.Credential) bool {
+	return false
+}
+
+// Tests whether the realm key is the required one.
+func (realm RealmRequirement) SatisfiedIn(credential credentials.Credential, realmKey string) bool {
+	return string(realm) == realmKey
+}
+
+// This requirement checks whether the credential
+// logged in through any of the given realms. Like
+// RealmRequirement, a bare SatisfiedBy call will
+// always fail.
+type RealmsRequirement []string
+
+// Always fails, since the realm is unknown.
+func (realms RealmsRequirement) SatisfiedBy(credential credentials.Credential) bool {
+	return false
+}
+
+// Tests whether the realm key is among the required ones.
+func (realms RealmsRequirement) SatisfiedIn(credential credentials.Credential, realmKey string) bool {
+	for _, key := range realms {
+		if key == realmKey {
+			return true
+		}
+	}
+	return false
+}
+
+// This requirement succeeds when all of its
+// children requirements succeed.
+type AllRequirement []authreqs.AuthorizationRequirement
+
+// Tests all the children, without realm.
+func (all AllRequirement) SatisfiedBy(credential credentials.Credential) bool {
+	for _, requirement := range all {
+		if !requirement.SatisfiedBy(credential) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tests all the children, with realm.
+func (all AllRequirement) SatisfiedIn(credential credentials.Credential, realmKey string) bool {
+	return all.satisfiedWithin(credential, scope{realmKey: realmKey})
+}
+
+// The children requirements.
+func (all AllRequirement) children() []authreqs.AuthorizationRequirement {
+	return all
+}
+
+// Tests all the children, within a scope.
+func (all AllRequirement) satisfiedWithin(credential credentials.Credential, within scope) bool {
+	for _, requirement := range all {
+		if !evaluate(requirement, credential, within) {
+			return false
+		}
+	}
+	return true
+}
+
+// This requirement succeeds when any of its
+// children requirements succeeds.
+type AnyRequirement []authreqs.AuthorizationRequirement
+
+// Tests the children one-by-one, without realm,
+// until one succeeds.
+func (any AnyRequirement) SatisfiedBy(credential credentials.Credential) bool {
+	for _, requirement := range any {
+		if requirement.SatisfiedBy(credential) {
+			return true
+		}
+	}
+	return false
+}
+
+// Tests the children one-by-one, with realm,
+// until one succeeds.
+func (any AnyRequirement) SatisfiedIn(credential credentials.Credential, realmKey string) bool {
+	return any.satisfiedWithin(credential, scope{realmKey: realmKey})
+}
+
+// The children requirements.
+func (any AnyRequirement) children() []authreqs.AuthorizationRequirement {
+	return any
+}
+
+// Tests the children one-by-one, within a scope,
+// until one succeeds.
+func (any AnyRequirement) satisfiedWithin(credential credentials.Credential, within scope) bool {
+	for _, requirement := range any {
+		if evaluate(requirement, credential, within) {
+			return true
+		}
+	}
+	return false
+}
+
+// This requirement succeeds when its inner
+// requirement fails. When the inner requirement
+// cannot be evaluated for lack of context (e.g. a
+// bare SatisfiedBy call on a realm-aware one, which
+// would always fail), this requirement fails too,
+// instead of succeeding.
+type NotRequirement struct {
+	requirement authreqs.AuthorizationRequirement
+}
+
+// Negates the inner requirement, without realm. Fails
+// if the inner requirement depends on the realm or on
+// the message.
+func (not NotRequirement) SatisfiedBy(credential credentials.Credential) bool {
+	if dependsOnRealm(not.requirement) || DependsOnMessage(not.requirement) {
+		return false
+	}
+	return !not.requirement.SatisfiedBy(credential)
+}
+
+// Negates the inner requirement, with realm.
+func (not NotRequirement) SatisfiedIn(credential credentials.Credential, realmKey string) bool {
+	return not.satisfiedWithin(credential, scope{realmKey: realmKey})
+}
+
+// The inner requirement, as single child.
+func (not NotRequirement) children() []authreqs.AuthorizationRequirement {
+	return []authreqs.AuthorizationRequirement{not.requirement}
+}
+
+// Negates the inner requirement, within a scope. Fails
+// if the inner requirement depends on the message, and
+// the scope has no message.
+func (not NotRequirement) satisfiedWithin(credential credentials.Credential, within scope) bool {
+	if within.message == nil && DependsOnMessage(not.requirement) {
+		return false
+	}
+	return !evaluate(not.requirement, credential, within)
+}
+
+// Requires the credential to have the given role.
+func HasRole(role string) RoleRequirement {
+	return RoleRequirement(role)
+}
+
+// Requires the credential to have the given permission.
+func HasPermission(permission string) AnyPermissionRequirement {
+	return AnyPermissionRequirement{permission}
+}
+
+// Requires the credential to have any of the given permissions.
+func HasAnyPermission(permissions ...string) AnyPermissionRequirement {
+	return permissions
+}
+
+// Requires the credential to have logged in through the
+// realm with the given key.
+func InRealm(key string) RealmRequirement {
+	return RealmRequirement(key)
+}
+
+// Requires the credential to have logged in through any
+// of the realms with the given keys.
+func InRealms(keys ...string) RealmsRequirement {
+	return keys
+}
+
+// Requires all of the given requirements.
+func All(requirements ...authreqs.AuthorizationRequirement) AllRequirement {
+	return requirements
+}
+
+// Requires any of the given requirements.
+func Any(requirements ...authreqs.AuthorizationRequirement) AnyRequirement {
+	return requirements
+}
+
+// Requires the given requirement to fail.
+func Not(requirement authreqs.AuthorizationRequirement) NotRequirement {
+	return NotRequirement{requirement}
+}
+
+var _ RealmAwareRequirement = RealmRequirement("")
+var _ RealmAwareRequirement = RealmsRequirement{}
+var _ RealmAwareRequirement = AllRequirement{}
+var _ RealmAwareRequirement = AnyRequirement{}
+var _ RealmAwareRequirement = NotRequirement{}
+var _ combinator = AllRequirement{}
+var _ combinator = AnyRequirement{}
+var _ combinator = NotRequirement{}
@@ -0,0 +1,49 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// Satisfied for the "allowed" command only.
+var allowedCommand = MessageRequirementFunc(func(_ credentials.Credential, _ *chasqui.Attendant, message types.Message) bool {
+	return message.Command() == "allowed"
+})
+
+func TestNotFailsClosedWithoutContext(t *testing.T) {
+	for name, requirement := range map[string]authreqs.AuthorizationRequirement{
+		"realm":          Not(InRealm("main")),
+		"realms":         Not(InRealms("main", "admin")),
+		"message":        Not(allowedCommand),
+		"nested realm":   Not(Any(InRealm("main"), HasRole("admin"))),
+		"double":         Not(Not(InRealm("main"))),
+		"nested message": Not(All(allowedCommand)),
+	} {
+		if requirement.SatisfiedBy(nil) {
+			t.Errorf("%s: a bare SatisfiedBy call must fail", name)
+		}
+	}
+	if Satisfied(Not(allowedCommand), nil, "main") {
+		t.Error("negating a message-aware requirement without a message must fail")
+	}
+}
+
+func TestNotNegatesWithinContext(t *testing.T) {
+	if !Satisfied(Not(InRealm("main")), nil, "other") || Satisfied(Not(InRealm("main")), nil, "main") {
+		t.Error("Not(InRealm) must negate the realm check")
+	}
+	if !SatisfiedFor(Not(allowedCommand), nil, "main", nil, harness.NewMessage("other")) {
+		t.Error("Not(message-aware) must succeed for other commands")
+	}
+	if SatisfiedFor(Not(allowedCommand), nil, "main", nil, harness.NewMessage("allowed")) {
+		t.Error("Not(message-aware) must fail for the allowed command")
+	}
+	if !Satisfied(Not(Not(InRealm("main"))), nil, "main") {
+		t.Error("a double negation must be satisfied in the realm")
+	}
+}
@@ -0,0 +1,79 @@
+package authz
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A message-aware requirement is also tested against
+// the attendant and the message being handled, so it
+// can authorize on the resources the message refers
+// to (e.g. "may edit only their own room"). Protocols
+// wrapping handlers will detect these requirements and
+// provide the attendant and the message.
+type MessageAwareRequirement interface {
+	authreqs.AuthorizationRequirement
+	// A mean to test whether a particular credential,
+	// in a particular attendant, may handle a message.
+	SatisfiedFor(credential credentials.Credential, attendant *chasqui.Attendant, message types.Message) bool
+}
+
+// A message-aware requirement made from a function.
+// A bare SatisfiedBy call always fails, since the
+// message is unknown.
+type MessageRequirementFunc func(credential credentials.Credential, attendant *chasqui.Attendant, message types.Message) bool
+
+// Always fails, since the message is unknown.
+func (function MessageRequirementFunc) SatisfiedBy(credential credentials.Credential) bool {
+	return false
+}
+
+// Invokes the function.
+func (function MessageRequirementFunc) SatisfiedFor(credential credentials.Credential, attendant *chasqui.Attendant, message types.Message) bool {
+	return function(credential, attendant, message)
+}
+
+// A resource extractor tells the id of the resource a
+// message refers to, and whether it is present.
+type ResourceExtractor func(message types.Message) (interface{}, bool)
+
+// Extracts the resource id from a positional argument
+// of the message. It is absent if the message has not
+// enough arguments.
+func ArgResource(index int) ResourceExtractor {
+	return func(message types.Message) (interface{}, bool) {
+		if args := message.Args(); index >= 0 && index < len(args) {
+			return args[index], true
+		}
+		return nil, false
+	}
+}
+
+// Extracts the resource id from a keyword argument of
+// the message. It is absent if the message does not
+// have the keyword argument.
+func KWArgResource(key string) ResourceExtractor {
+	return func(message types.Message) (interface{}, bool) {
+		value, ok := message.KWArgs()[key]
+		return value, ok
+	}
+}
+
+// An ownership check tells whether a credential owns
+// (or may otherwise act upon) a given resource.
+type OwnershipCheck func(credential credentials.Credential, resource interface{}) bool
+
+// Requires the credential to own the resource the message
+// refers to. Messages without the resource id fail.
+func Owns(extractor ResourceExtractor, check OwnershipCheck) MessageRequirementFunc {
+	return func(credential credentials.Credential, attendant *chasqui.Attendant, message types.Message) bool {
+		if resource, ok := extractor(message); ok {
+			return check(credential, resource)
+		}
+		return false
+	}
+}
+
+var _ MessageAwareRequirement = MessageRequirementFunc(nil)
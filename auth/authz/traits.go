@@ -0,0 +1,13 @@
+package authz
+
+// This trait makes the credential hold a bunch
+// of roles and a bunch of permissions, to be
+// tested by the role/permission requirements
+// of this package. Both are sets, keyed by the
+// role or permission name.
+type Privileged interface {
+	// The roles the credential has.
+	Roles() map[string]bool
+	// The permissions the credential has.
+	Permissions() map[string]bool
+}
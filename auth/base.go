@@ -3,10 +3,17 @@ package auth
 import (
 	"github.com/universe-10th/chasqui"
 	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/metrics"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/policy"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/ratelimit"
 	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
 	protocols "github.com/universe-10th/chasqui-protocols"
 	types2 "github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/authreqs"
 	"github.com/universe-10th/identity/realms"
+	"sync"
+	"time"
 )
 
 // An auth protocol provides handlers for several
@@ -33,6 +40,12 @@ type AuthProtocol struct {
 	// A pre-computed string: "{prefix}key", like "auth.key".
 	// Users will not set this field.
 	currentQualifiedKeyContextKey string
+	// A pre-computed string: "{prefix}session", like "auth.session".
+	// Users will not set this field.
+	currentSessionContextKey string
+	// A pre-computed string: "{prefix}resume-token", like
+	// "auth.resume-token". Users will not set this field.
+	currentResumeTokenContextKey string
 	// All the available login realms for login and permission check.
 	// Realms are created beforehand (on protocol instantiation).
 	realms map[string]*realms.Realm
@@ -44,17 +57,83 @@ type AuthProtocol struct {
 	notLoggedInHandler protocols.MessageHandler
 	// A default handler for when a permission is denied.
 	permissionDeniedHandler protocols.MessageHandler
+	// A default handler for when a command is throttled.
+	throttledHandler protocols.MessageHandler
+	// Tells the remote address of an attendant, to be kept
+	// in their sessions. This is optional.
+	remoteAddressResolver func(*chasqui.Attendant) string
+	// Tells whether the other sessions of a credential must
+	// be logged out after a successful password change.
+	logoutOthersOnPasswordChange bool
+	// The grace period a session is held for, after its
+	// attendant disconnects, so it can be resumed from a
+	// new attendant. Zero disables session resumption.
+	resumptionGrace time.Duration
+	// The sessions currently being held, by resume token.
+	heldSessions map[string]*heldSession
+	// Guards the held sessions, since they expire in their
+	// own goroutines.
+	heldMutex sync.Mutex
+	// Serializes the accesses to the attendants' contexts,
+	// since held sessions are expired in timer goroutines.
+	// It also guards the attendants being logged out.
+	contextMutex sync.Mutex
+	loggingOut   map[*chasqui.Attendant]bool
+	// The interval after which the credential of a session
+	// is reloaded from its realm, when the session issues
+	// an authorized command. Zero disables the periodic
+	// refresh (credentials may still be refreshed by hand).
+	credentialRefreshInterval time.Duration
+	// An optional collector of metrics.
+	metrics *metrics.Collector
+	// Tells which realms are listed by the realms command.
+	// If nil, all of them are listed.
+	realmVisibility func(string) bool
+	// The requirement of each command wrapped by any of the
+	// RequireAuthorization* methods that take whole handler
+	// maps, or registered by hand. A nil requirement means
+	// that only login is required.
+	permissions map[string]authreqs.AuthorizationRequirement
+	// Guards the permissions registry.
+	permissionsMutex sync.RWMutex
+	// Tells whether authorization decisions are cached per
+	// session (and per requirement).
+	cacheAuthorization bool
+	// Hits and misses of the authorization cache. They must
+	// be accessed atomically.
+	authorizationCacheHits   uint64
+	authorizationCacheMisses uint64
+	// The optional rate limits of the commands requiring
+	// login, per credential, and their buckets. Buckets are
+	// keyed by qualified key, so they are shared among all
+	// the sessions of a credential.
+	rateLimits  *ratelimit.Limits
+	rateLimiter *ratelimit.Limiter
+	// An optional policy engine, evaluated alongside the
+	// requirements of the wrapped handlers.
+	policy *policy.Engine
+	// The logger of the protocol decisions. By default,
+	// nothing is logged.
+	logger logging.Logger
 }
 
 // By default, the domain will be of a single-locking
 // type, and the notLoggedIn / permissionDenied handlers
 // will just send standard messages to the attendants.
+// Also, other sessions will be logged out on password
+// changes.
 func NewAuthProtocol(realms map[string]*realms.Realm, options ...AuthOption) *AuthProtocol {
 	protocol := &AuthProtocol{
 		WithAuthEvents: events.NewWithAuthEvents(),
 		realms:         realms,
 		prefix:         "auth",
 		domain:         types.NewDomain(types.SingleLocking, nil),
+		heldSessions:   map[string]*heldSession{},
+		loggingOut:     map[*chasqui.Attendant]bool{},
+		permissions:    map[string]authreqs.AuthorizationRequirement{},
+		logger:         logging.Nop,
+
+		logoutOthersOnPasswordChange: true,
 	}
 
 	protocol.notLoggedInHandler = func(server *chasqui.Server, attendant *chasqui.Attendant, message types2.Message) {
@@ -65,6 +144,10 @@ func NewAuthProtocol(realms map[string]*realms.Realm, options ...AuthOption) *Au
 		// noinspection GoUnhandledErrorResult
 		attendant.Send(protocol.prefix+"permission-denied", nil, nil)
 	}
+	protocol.throttledHandler = func(server *chasqui.Server, attendant *chasqui.Attendant, message types2.Message) {
+		// noinspection GoUnhandledErrorResult
+		attendant.Send(protocol.prefix+"throttled", types2.Args{message.Command()}, nil)
+	}
 
 	for _, option := range options {
 		option(protocol)
@@ -74,9 +157,21 @@ func NewAuthProtocol(realms map[string]*realms.Realm, options ...AuthOption) *Au
 		protocol.prefix = protocol.prefix + "."
 		protocol.currentUserContextKey = protocol.prefix + "user"
 		protocol.currentQualifiedKeyContextKey = protocol.prefix + "key"
+		protocol.currentSessionContextKey = protocol.prefix + "session"
+		protocol.currentResumeTokenContextKey = protocol.prefix + "resume-token"
 	} else {
 		protocol.currentUserContextKey = "user"
 		protocol.currentQualifiedKeyContextKey = "key"
+		protocol.currentSessionContextKey = "session"
+		protocol.currentResumeTokenContextKey = "resume-token"
+	}
+
+	if protocol.metrics != nil {
+		protocol.collectMetrics()
+	}
+
+	if protocol.logger == nil {
+		protocol.logger = logging.Nop
 	}
 
 	return protocol
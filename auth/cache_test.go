@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A requirement counting its evaluations.
+type countingRequirement struct {
+	evaluations *int
+}
+
+func (requirement countingRequirement) SatisfiedBy(credentials.Credential) bool {
+	*requirement.evaluations++
+	return true
+}
+
+// Wraps a handler doing nothing, with a requirement.
+func guarded(protocol *AuthProtocol, requirement authreqs.AuthorizationRequirement) func(*chasqui.Server, *chasqui.Attendant, types.Message) {
+	return protocol.RequireAuthorization(requirement, func(*chasqui.Server, *chasqui.Attendant, types.Message) {})
+}
+
+func TestCachedDecisionsAreSharedByRequirement(t *testing.T) {
+	protocol := newTestProtocol(WithAuthorizationCache)
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+
+	evaluations := 0
+	requirement := countingRequirement{&evaluations}
+	first, second := guarded(protocol, requirement), guarded(protocol, requirement)
+	for index := 0; index < 3; index++ {
+		first(server, attendant, harness.NewMessage("first"))
+		second(server, attendant, harness.NewMessage("second"))
+	}
+	if evaluations != 1 {
+		t.Fatalf("expected a single evaluation, got %d", evaluations)
+	}
+	if hits, misses := protocol.AuthorizationCacheStats(); hits != 5 || misses != 1 {
+		t.Fatalf("expected 5 hits and 1 miss, got %d and %d", hits, misses)
+	}
+}
+
+func TestNonComparableRequirementsAreCachedByPointer(t *testing.T) {
+	protocol := newTestProtocol(WithAuthorizationCache)
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+
+	evaluations := 0
+	all := authz.All(countingRequirement{&evaluations})
+	not := authz.Not(authz.Not(all))
+	handlers := []func(*chasqui.Server, *chasqui.Attendant, types.Message){
+		guarded(protocol, all), guarded(protocol, all), guarded(protocol, not),
+	}
+	for index := 0; index < 2; index++ {
+		for _, handler := range handlers {
+			handler(server, attendant, harness.NewMessage("test"))
+		}
+	}
+	// The slice is shared by the first two handlers, and the
+	// negation (not comparable, having a slice) is not cached.
+	if evaluations != 3 {
+		t.Fatalf("expected 3 evaluations, got %d", evaluations)
+	}
+}
+
+func TestCachedDecisionsAreInvalidated(t *testing.T) {
+	for name, invalidate := range map[string]func(*AuthProtocol, *chasqui.Server, *chasqui.Attendant){
+		"invalidate": func(protocol *AuthProtocol, _ *chasqui.Server, attendant *chasqui.Attendant) {
+			protocol.InvalidateAuthorization(attendant)
+		},
+		"refresh": func(protocol *AuthProtocol, server *chasqui.Server, attendant *chasqui.Attendant) {
+			if err := protocol.RefreshCredential(server, *protocol.getQualifiedKey(attendant, false)); err != nil {
+				t.Fatal(err)
+			}
+		},
+		"logout": func(protocol *AuthProtocol, server *chasqui.Server, attendant *chasqui.Attendant) {
+			protocol.Logout(server, attendant, events.Graceful, "")
+			login(t, protocol, server, attendant, "alice")
+		},
+	} {
+		protocol := newTestProtocol(WithAuthorizationCache)
+		server, attendant := harness.NewServer(), harness.NewAttendant(t)
+		login(t, protocol, server, attendant, "alice")
+
+		evaluations := 0
+		handler := guarded(protocol, countingRequirement{&evaluations})
+		handler(server, attendant, harness.NewMessage("test"))
+		handler(server, attendant, harness.NewMessage("test"))
+		invalidate(protocol, server, attendant)
+		handler(server, attendant, harness.NewMessage("test"))
+		if evaluations != 2 {
+			t.Errorf("%s: expected 2 evaluations, got %d", name, evaluations)
+		}
+	}
+}
@@ -1,8 +1,14 @@
 package auth
 
 import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/metrics"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/policy"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/ratelimit"
 	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
 	protocols "github.com/universe-10th/chasqui-protocols"
+	"time"
 )
 
 // This type represents an option to the NewAuthProtocol()
@@ -57,6 +63,140 @@ func WithDefaultPermissionDenied(permissionDenied protocols.MessageHandler) Auth
 	}
 }
 
+// This option-maker returns an option that sets
+// the handler of the case when an attendant issues
+// a command beyond its rate limit.
+func WithDefaultThrottled(throttled protocols.MessageHandler) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.throttledHandler = throttled
+	}
+}
+
+// This option-maker returns an option that sets the
+// rate limits of the commands requiring login. Each
+// credential has a token bucket, shared among all its
+// sessions, and its limit is selected by its roles or
+// realm. Commands beyond the limit are given to the
+// throttled handler. The own commands of the protocol
+// (e.g. logout) are never limited. If this option is
+// not used, the commands are not limited.
+func WithRateLimits(limits ratelimit.Limits) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.rateLimits = &limits
+		protocol.rateLimiter = ratelimit.NewLimiter()
+	}
+}
+
+// This option-maker returns an option that sets the
+// function used to tell the remote address of an
+// attendant when a session is created. If this option
+// is not used, sessions will have an empty address.
+func WithRemoteAddressResolver(resolver func(*chasqui.Attendant) string) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.remoteAddressResolver = resolver
+	}
+}
+
+// This option-maker returns an option that tells
+// whether, after a successful password change, the
+// other sessions of the same credential must be
+// logged out. If this option is not used, they will.
+func WithLogoutOthersOnPasswordChange(enabled bool) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.logoutOthersOnPasswordChange = enabled
+	}
+}
+
+// This option-maker returns an option that enables
+// session resumption: when a logged attendant gets
+// disconnected, its session is held for the given
+// grace period and can be resumed, from another
+// attendant, by using the resume token sent on login.
+// If this option is not used, sessions are logged out
+// as soon as their attendants disconnect.
+func WithResumption(grace time.Duration) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.resumptionGrace = grace
+	}
+}
+
+// This option-maker returns an option that enables
+// the lazy refresh of credentials: when a session
+// issues a command requiring login, its credential is
+// reloaded from its realm if it was loaded longer than
+// the given interval ago. There is no background
+// refresh: idle sessions keep their credential until
+// their next command. If the credential no longer
+// exists in its realm, its sessions in that server
+// are logged out and the command is not run. Other
+// refresh errors keep the current credential, and the
+// refresh is retried after a back-off. If this option
+// is not used, credentials are only refreshed by the
+// RefreshCredential method.
+func WithCredentialRefresh(interval time.Duration) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.credentialRefreshInterval = interval
+	}
+}
+
+// This option-maker returns an option that sets the
+// criterion telling which realms are listed to the
+// clients by the realms command. Hidden realms can
+// still be used to log in. If this option is not
+// used, all the realms are listed.
+func WithRealmVisibility(visible func(key string) bool) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.realmVisibility = visible
+	}
+}
+
+// This option enables the per-session cache of
+// authorization decisions: the outcome of each requirement
+// is remembered in the session (and shared among all the
+// handlers wrapped with equal requirements), until logout,
+// credential refresh or a call to the
+// InvalidateAuthorization method. Requirements that depend
+// on the message are never cached.
+func WithAuthorizationCache(protocol *AuthProtocol) {
+	protocol.cacheAuthorization = true
+}
+
+// This option-maker returns an option that sets a
+// policy engine for the being-built protocol. Every
+// handler requiring login will also be checked against
+// the engine's rules, and the denying rule is reported
+// as the requirement of the authorization denied event.
+func WithPolicy(engine *policy.Engine) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.policy = engine
+	}
+}
+
+// This option-maker returns an option that sets a
+// collector of metrics for the being-built protocol.
+// The collector will be fed by the protocol events.
+func WithMetrics(collector *metrics.Collector) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.metrics = collector
+	}
+}
+
+// This option-maker returns an option that sets a
+// structured logger for the being-built protocol. It
+// will be told about every decision (invalid formats,
+// login outcomes, rejections, ghosting, logouts and
+// denials), with secret values always redacted. It will
+// also become the logger of the panics in the callbacks
+// of the events (see SetPanicLogger).
+func WithLogger(logger logging.Logger) AuthOption {
+	return func(protocol *AuthProtocol) {
+		protocol.logger = logger
+		if logger != nil {
+			protocol.SetPanicLogger(logger)
+		}
+	}
+}
+
 // This option-maker returns an option that sets
 // the prefix to use in the auth protocol. If this
 // option is not used, the prefix will be "auth".
@@ -0,0 +1,35 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// An authorization denial callback. It receives the
+// attendant, its credential, the requirement that was
+// not satisfied and the command being attempted.
+type AuthorizationDeniedCallback func(*chasqui.Server, *chasqui.Attendant, credentials.Credential, authreqs.AuthorizationRequirement, string)
+
+// Authorization denied events involve a logged attendant
+// attempting a command whose requirement its credential
+// does not satisfy. Callbacks can be registered to attend
+// this event.
+type AuthorizationDeniedEvent struct {
+	Event
+}
+
+// Registers a non-null authorization denial callback.
+func (event *AuthorizationDeniedEvent) Register(callback AuthorizationDeniedCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return event.subscribe(callback, options)
+}
+
+// Triggers all the callbacks. Hopefully, few callbacks will be triggered.
+func (event *AuthorizationDeniedEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, requirement authreqs.AuthorizationRequirement, command string) {
+	event.dispatch(func(callback interface{}) {
+		callback.(AuthorizationDeniedCallback)(server, attendant, credential, requirement, command)
+	})
+}
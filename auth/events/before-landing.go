@@ -0,0 +1,39 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A before-landing callback. It receives the credential
+// that successfully logged in, its qualified key and the
+// attendant. Returning an error aborts the login: the
+// error message will be sent to the client as the reason.
+type BeforeLandingCallback func(credentials.Credential, types.QualifiedKey, *chasqui.Attendant) error
+
+// Before-landing hooks run, synchronously and in order,
+// after the credentials were checked but before the
+// session lands in the domain, and also before a held
+// session is resumed in a new attendant. Any of them can
+// veto the login (or resume) attempt.
+type BeforeLandingHook struct {
+	Event
+}
+
+// Registers a non-null before-landing callback.
+func (hook *BeforeLandingHook) Register(callback BeforeLandingCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return hook.subscribe(callback, options)
+}
+
+// Runs all the callbacks in order, until one of them
+// returns an error. That error is returned, or nil if
+// all the callbacks allowed the landing to continue.
+func (hook *BeforeLandingHook) Run(credential credentials.Credential, key types.QualifiedKey, attendant *chasqui.Attendant) error {
+	return hook.dispatchUntil(func(callback interface{}) error {
+		return callback.(BeforeLandingCallback)(credential, key, attendant)
+	})
+}
@@ -0,0 +1,40 @@
+package events
+
+import (
+	"errors"
+	"github.com/universe-10th/chasqui"
+)
+
+// Returned when a "before" hook panicked. The login
+// attempt will be aborted, as if the hook vetoed it.
+var ErrHookPanicked = errors.New("login aborted")
+
+// A before-login callback. It receives the identifier,
+// the realm key and the attendant attempting the login.
+// Returning an error aborts the login: the error message
+// will be sent to the client as the reason.
+type BeforeLoginCallback func(interface{}, string, *chasqui.Attendant) error
+
+// Before-login hooks run, synchronously and in order,
+// before the credentials are checked. Any of them can
+// veto the login attempt.
+type BeforeLoginHook struct {
+	Event
+}
+
+// Registers a non-null before-login callback.
+func (hook *BeforeLoginHook) Register(callback BeforeLoginCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return hook.subscribe(callback, options)
+}
+
+// Runs all the callbacks in order, until one of them
+// returns an error. That error is returned, or nil if
+// all the callbacks allowed the login to continue.
+func (hook *BeforeLoginHook) Run(identifier interface{}, realm string, attendant *chasqui.Attendant) error {
+	return hook.dispatchUntil(func(callback interface{}) error {
+		return callback.(BeforeLoginCallback)(identifier, realm, attendant)
+	})
+}
@@ -0,0 +1,281 @@
+package events
+
+import (
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// A subscription is the registration of a callback in
+// an event. It keeps the priority of the callback, and
+// can be cancelled to stop receiving the event.
+type Subscription struct {
+	id        uint64
+	priority  int
+	callback  interface{}
+	event     *Event
+	cancelled int32
+	// Asynchronous delivery settings, and the queue
+	// (only for asynchronous subscriptions).
+	async    bool
+	capacity int
+	policy   OverflowPolicy
+	queue    *deliveryQueue
+	dropped  uint64
+}
+
+// The priority of this subscription. Subscriptions with
+// higher priorities are dispatched first.
+func (subscription *Subscription) Priority() int {
+	return subscription.priority
+}
+
+// Tells whether this subscription delivers the event
+// asynchronously, through a bounded queue.
+func (subscription *Subscription) Async() bool {
+	return subscription.async
+}
+
+// The number of events dropped by this subscription's
+// queue, due to its overflow policy.
+func (subscription *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&subscription.dropped)
+}
+
+// Tells whether this subscription was cancelled.
+func (subscription *Subscription) Cancelled() bool {
+	return atomic.LoadInt32(&subscription.cancelled) != 0
+}
+
+// Cancels this subscription, so its callback will not
+// be invoked anymore. It is safe to cancel a subscription
+// while the event is being dispatched (even from inside
+// the callback itself), and to cancel it more than once.
+// Events still queued for an asynchronous subscription
+// will be discarded.
+func (subscription *Subscription) Cancel() {
+	if atomic.CompareAndSwapInt32(&subscription.cancelled, 0, 1) {
+		subscription.event.remove(subscription)
+		if subscription.queue != nil {
+			subscription.queue.close()
+		}
+	}
+}
+
+// This type represents an option to the registration of
+// a callback in an event.
+type SubscriptionOption func(subscription *Subscription)
+
+// This option-maker returns an option that sets the
+// priority of the subscription. Subscriptions with
+// higher priorities are dispatched first, and those
+// with the same priority are dispatched in the order
+// they were registered. The default priority is 0.
+func WithPriority(priority int) SubscriptionOption {
+	return func(subscription *Subscription) {
+		subscription.priority = priority
+	}
+}
+
+// This option-maker returns an option that makes the
+// subscription asynchronous: the event is delivered to
+// the callback by a dedicated goroutine, through a queue
+// of the given capacity. When the queue is full, the
+// given policy applies. Hooks (which must return their
+// result synchronously) ignore this option.
+func WithAsyncDelivery(capacity int, policy OverflowPolicy) SubscriptionOption {
+	return func(subscription *Subscription) {
+		subscription.async = true
+		subscription.capacity = capacity
+		subscription.policy = policy
+	}
+}
+
+// An event is the shared dispatcher every auth event and
+// hook is built on. It keeps its subscriptions sorted by
+// priority and registration order, so the dispatch order
+// is deterministic. All the operations are safe to be
+// used from several goroutines.
+type Event struct {
+	name          string
+	counter       uint64
+	subscriptions []*Subscription
+	mutex         sync.RWMutex
+	// The number of events dropped by all the queues of the
+	// asynchronous subscriptions of this event.
+	dropped uint64
+	// Tells whether the event was closed. Asynchronous
+	// subscriptions made after closing are delivered
+	// synchronously.
+	closed bool
+	// Reports the panics in the callbacks. If nil, the
+	// panics are silently recovered.
+	reporter *panicReporter
+}
+
+// The name of this event.
+func (event *Event) Name() string {
+	return event.name
+}
+
+// The number of active subscriptions in this event.
+func (event *Event) Len() int {
+	event.mutex.RLock()
+	defer event.mutex.RUnlock()
+	return len(event.subscriptions)
+}
+
+// The number of events dropped by all the queues of the
+// asynchronous subscriptions of this event.
+func (event *Event) Dropped() uint64 {
+	return atomic.LoadUint64(&event.dropped)
+}
+
+// Waits until all the asynchronous subscriptions of this
+// event deliver their queued events. This must not be
+// called from inside an asynchronous callback.
+func (event *Event) Flush() {
+	for _, subscription := range event.snapshot() {
+		if subscription.queue != nil {
+			subscription.queue.flush()
+		}
+	}
+}
+
+// Closes all the queues of the asynchronous subscriptions
+// of this event, and waits until they deliver their queued
+// events. Further events, for those subscriptions, will be
+// dropped. This must not be called from inside an async
+// callback.
+func (event *Event) Close() {
+	event.mutex.Lock()
+	event.closed = true
+	event.mutex.Unlock()
+	for _, subscription := range event.snapshot() {
+		if subscription.queue != nil {
+			subscription.queue.close()
+			subscription.queue.wait()
+		}
+	}
+}
+
+// Registers a callback with the given options. The callback
+// must not be nil, and must be of the type the concrete event
+// expects when dispatching.
+func (event *Event) subscribe(callback interface{}, options []SubscriptionOption) *Subscription {
+	event.mutex.Lock()
+	defer event.mutex.Unlock()
+
+	subscription := &Subscription{id: event.counter, callback: callback, event: event}
+	event.counter++
+	for _, option := range options {
+		option(subscription)
+	}
+	if subscription.async && !event.closed {
+		subscription.queue = newDeliveryQueue(subscription.capacity, subscription.policy, &subscription.dropped, &event.dropped)
+	}
+
+	// Insert after all the subscriptions having a greater or
+	// equal priority, keeping the slice sorted. A new slice is
+	// built, so current snapshots are not affected.
+	index := sort.Search(len(event.subscriptions), func(index int) bool {
+		return event.subscriptions[index].priority < subscription.priority
+	})
+	subscriptions := make([]*Subscription, 0, len(event.subscriptions)+1)
+	subscriptions = append(subscriptions, event.subscriptions[:index]...)
+	subscriptions = append(subscriptions, subscription)
+	subscriptions = append(subscriptions, event.subscriptions[index:]...)
+	event.subscriptions = subscriptions
+	return subscription
+}
+
+// Removes a subscription. A new slice is built, so current
+// snapshots are not affected.
+func (event *Event) remove(subscription *Subscription) {
+	event.mutex.Lock()
+	defer event.mutex.Unlock()
+
+	subscriptions := make([]*Subscription, 0, len(event.subscriptions))
+	for _, current := range event.subscriptions {
+		if current != subscription {
+			subscriptions = append(subscriptions, current)
+		}
+	}
+	event.subscriptions = subscriptions
+}
+
+// Gets the current subscriptions. The returned slice is never
+// modified afterwards, so it can be iterated without the lock.
+func (event *Event) snapshot() []*Subscription {
+	event.mutex.RLock()
+	defer event.mutex.RUnlock()
+	return event.subscriptions
+}
+
+// Reports a panic recovered from one of the callbacks.
+// Panics of asynchronous deliveries are never re-raised.
+func (event *Event) report(recovered interface{}, async bool) {
+	if event.reporter != nil {
+		event.reporter.report(event.name, recovered, debug.Stack(), async)
+	}
+}
+
+// Wraps and invokes a callback, by calling it and reporting
+// any panic.
+func (event *Event) invoke(subscription *Subscription, invoke func(interface{})) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			event.report(recovered, subscription.queue != nil)
+		}
+	}()
+	invoke(subscription.callback)
+}
+
+// Dispatches the event to all the subscriptions, in order. The
+// invoke function must cast the callback to its concrete type
+// and call it with the event's arguments.
+// Asynchronous subscriptions get the invocation queued.
+func (event *Event) dispatch(invoke func(interface{})) {
+	for _, subscription := range event.snapshot() {
+		if subscription.Cancelled() {
+			continue
+		}
+		if subscription.queue != nil {
+			current := subscription
+			current.queue.push(func() {
+				if !current.Cancelled() {
+					event.invoke(current, invoke)
+				}
+			})
+		} else {
+			event.invoke(subscription, invoke)
+		}
+	}
+}
+
+// Wraps and invokes a veto-able callback, by calling it and
+// reporting any panic, which becomes an ErrHookPanicked error.
+func (event *Event) invokeUntil(subscription *Subscription, invoke func(interface{}) error) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = ErrHookPanicked
+			event.report(recovered, false)
+		}
+	}()
+	return invoke(subscription.callback)
+}
+
+// Dispatches the event to all the subscriptions, in order,
+// until one of them returns an error. That error is returned,
+// or nil if all the subscriptions returned nil.
+func (event *Event) dispatchUntil(invoke func(interface{}) error) error {
+	for _, subscription := range event.snapshot() {
+		if !subscription.Cancelled() {
+			if err := event.invokeUntil(subscription, invoke); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
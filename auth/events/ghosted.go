@@ -0,0 +1,37 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A ghosting callback. It receives the attendant that
+// was ghosted (already logged out), the attendant whose
+// login caused it (not landed yet), the credential they
+// share, and the session that was ghosted (nil if the
+// ghosted attendant had none).
+type GhostedCallback func(*chasqui.Server, *chasqui.Attendant, *chasqui.Attendant, credentials.Credential, *types.Session)
+
+// Ghosted events involve a session being kicked by a new
+// login of the same credential, according to the domain
+// rule. Callbacks can be registered to attend this event.
+type GhostedEvent struct {
+	Event
+}
+
+// Registers a non-null ghosting callback.
+func (event *GhostedEvent) Register(callback GhostedCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return event.subscribe(callback, options)
+}
+
+// Triggers all the callbacks. Hopefully, few callbacks will be triggered.
+func (event *GhostedEvent) Trigger(server *chasqui.Server, ghosted, by *chasqui.Attendant, credential credentials.Credential,
+	session *types.Session) {
+	event.dispatch(func(callback interface{}) {
+		callback.(GhostedCallback)(server, ghosted, by, credential, session)
+	})
+}
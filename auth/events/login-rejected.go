@@ -0,0 +1,35 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A login rejection callback. It receives the attendant
+// attempting the login, the credential that successfully
+// logged in and its qualified key.
+type LoginRejectedCallback func(*chasqui.Server, *chasqui.Attendant, credentials.Credential, types.QualifiedKey)
+
+// Login rejected events involve a successful login being
+// rejected by the domain rule (e.g. the credential is
+// already logged in). Callbacks can be registered to
+// attend this event.
+type LoginRejectedEvent struct {
+	Event
+}
+
+// Registers a non-null login rejection callback.
+func (event *LoginRejectedEvent) Register(callback LoginRejectedCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return event.subscribe(callback, options)
+}
+
+// Triggers all the callbacks. Hopefully, few callbacks will be triggered.
+func (event *LoginRejectedEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, key types.QualifiedKey) {
+	event.dispatch(func(callback interface{}) {
+		callback.(LoginRejectedCallback)(server, attendant, credential, key)
+	})
+}
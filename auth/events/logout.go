@@ -3,7 +3,6 @@ package events
 import (
 	"github.com/universe-10th/chasqui"
 	"github.com/universe-10th/identity/credentials"
-	"sync"
 )
 
 // The stage to catch the logout event: before logging
@@ -16,57 +15,73 @@ const (
 	After
 )
 
+// The kind of a logout, telling why it happened. It
+// is sent to the client, and also received by the
+// logout callbacks along with a free-form reason.
+type LogoutKind uint8
+
+const (
+	// The user asked to log out.
+	Graceful LogoutKind = iota
+	// A new login of the same credential kicked the
+	// session, according to the domain rule.
+	Ghosted
+	// The session was kicked by the user itself or by
+	// the system (e.g. after a password change).
+	Forced
+	// The session was held after a disconnection, and
+	// it was not resumed in time.
+	Expired
+	// The attendant disconnected.
+	Disconnected
+	// An administrator kicked the session (e.g. via
+	// the protocol's LogoutAll method).
+	Admin
+)
+
+// The name of the logout kind, as sent to the client.
+func (kind LogoutKind) String() string {
+	switch kind {
+	case Graceful:
+		return "graceful"
+	case Ghosted:
+		return "ghosted"
+	case Forced:
+		return "forced"
+	case Expired:
+		return "expired"
+	case Disconnected:
+		return "disconnected"
+	case Admin:
+		return "admin"
+	default:
+		return "unknown"
+	}
+}
+
 // A logout success callback. Logout only means
-// dropping a context value in an attendant.
-type LogoutCallback func(*chasqui.Server, *chasqui.Attendant, credentials.Credential, LogoutStage)
+// dropping a context value in an attendant. The
+// kind and reason of the logout are also given.
+type LogoutCallback func(*chasqui.Server, *chasqui.Attendant, credentials.Credential, LogoutKind, string, LogoutStage)
 
 // Logout events involve a logout command to be
 // audited. Callbacks can be registered to attend
 // this event.
 type LogoutEvent struct {
-	counter   uint
-	callbacks map[uint]LogoutCallback
-	mutex     sync.Mutex
+	Event
 }
 
 // Registers a non-null logout callback.
-func (event *LogoutEvent) Register(callback LogoutCallback) func() {
-	const MaxInt = uint(^uint(0) >> 1)
-	event.mutex.Lock()
-	defer event.mutex.Unlock()
-
-	if callback == nil || uint(len(event.callbacks)) >= MaxInt {
+func (event *LogoutEvent) Register(callback LogoutCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
 		return nil
 	}
-
-	current := event.counter
-	event.callbacks[current] = callback
-
-	for {
-		if event.counter == MaxInt {
-			event.counter = 0
-		} else if _, ok := event.callbacks[event.counter]; ok {
-			event.counter++
-		} else {
-			break
-		}
-	}
-
-	return func() {
-		delete(event.callbacks, current)
-	}
-}
-
-// Wraps and triggers a callback, by calling it and diaper-catching
-// any panic.
-func (event *LogoutEvent) trigger(callback LogoutCallback, server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, stage LogoutStage) {
-	defer func() { recover() }()
-	callback(server, attendant, credential, stage)
+	return event.subscribe(callback, options)
 }
 
 // Triggers all the callbacks. Hopefully, few callbacks will be triggered.
-func (event *LogoutEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, stage LogoutStage) {
-	for _, callback := range event.callbacks {
-		event.trigger(callback, server, attendant, credential, stage)
-	}
+func (event *LogoutEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kind LogoutKind, reason string, stage LogoutStage) {
+	event.dispatch(func(callback interface{}) {
+		callback.(LogoutCallback)(server, attendant, credential, kind, reason, stage)
+	})
 }
@@ -0,0 +1,31 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+)
+
+// A not-logged-in access callback. It receives the
+// attendant and the command being attempted.
+type NotLoggedInCallback func(*chasqui.Server, *chasqui.Attendant, string)
+
+// Not-logged-in events involve an attendant attempting
+// a command that requires login, without being logged
+// in. Callbacks can be registered to attend this event.
+type NotLoggedInEvent struct {
+	Event
+}
+
+// Registers a non-null not-logged-in access callback.
+func (event *NotLoggedInEvent) Register(callback NotLoggedInCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return event.subscribe(callback, options)
+}
+
+// Triggers all the callbacks. Hopefully, few callbacks will be triggered.
+func (event *NotLoggedInEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, command string) {
+	event.dispatch(func(callback interface{}) {
+		callback.(NotLoggedInCallback)(server, attendant, command)
+	})
+}
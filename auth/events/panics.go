@@ -0,0 +1,54 @@
+package events
+
+import (
+	"fmt"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
+	"log"
+	"os"
+	"sync"
+)
+
+// A panic handler receives the name of the event whose
+// callback panicked, the recovered value, and the stack
+// trace of the panic.
+type PanicHandler func(event string, recovered interface{}, stack []byte)
+
+// Reports the panics occurring in the callbacks of all
+// the events of a WithAuthEvents instance. By default,
+// panics are logged to the standard error.
+type panicReporter struct {
+	mutex   sync.RWMutex
+	handler PanicHandler
+	logger  logging.Logger
+	repanic bool
+}
+
+// Creates a new panic reporter, logging to the standard
+// error and not re-panicking.
+func newPanicReporter() *panicReporter {
+	return &panicReporter{logger: logging.NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), logging.Error)}
+}
+
+// Reports a recovered panic of an event callback, either
+// through the custom handler or through the logger. Then,
+// panics again if told to, unless the callback was being
+// delivered asynchronously: nothing would recover such a
+// panic in the delivery goroutine, and the whole process
+// would crash.
+func (reporter *panicReporter) report(event string, recovered interface{}, stack []byte, async bool) {
+	reporter.mutex.RLock()
+	handler, logger, repanic := reporter.handler, reporter.logger, reporter.repanic
+	reporter.mutex.RUnlock()
+
+	if handler != nil {
+		handler(event, recovered, stack)
+	} else if logger != nil {
+		logger.Log(
+			logging.Error, "panic in an event callback", logging.F("event", event),
+			logging.F("panic", fmt.Sprint(recovered)), logging.F("stack", string(stack)),
+		)
+	}
+	if repanic && !async {
+		panic(recovered)
+	}
+}
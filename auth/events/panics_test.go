@@ -0,0 +1,68 @@
+package events
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
+)
+
+// A logger keeping all the entries.
+type recordingLogger struct {
+	mutex    sync.Mutex
+	messages []string
+	events   []interface{}
+}
+
+func (logger *recordingLogger) Log(level logging.Level, message string, fields ...logging.Field) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if level == logging.Error {
+		logger.messages = append(logger.messages, message)
+		logger.events = append(logger.events, fields[0].Value)
+	}
+}
+
+func panicking(*chasqui.Server, *chasqui.Attendant, string) {
+	panic("boom")
+}
+
+func TestPanicsAreLoggedThroughTheLogger(t *testing.T) {
+	withEvents := NewWithAuthEvents()
+	logger := &recordingLogger{}
+	withEvents.SetPanicLogger(logger)
+	withEvents.OnNotLoggedIn().Register(panicking)
+	withEvents.OnNotLoggedIn().Trigger(nil, nil, "command")
+	if len(logger.messages) != 1 || logger.events[0] != "not-logged-in" {
+		t.Fatalf("unexpected entries: %v %v", logger.messages, logger.events)
+	}
+}
+
+func TestSynchronousPanicsAreRaisedAgain(t *testing.T) {
+	withEvents := NewWithAuthEvents()
+	withEvents.SetPanicLogger(nil)
+	withEvents.SetRepanic(true)
+	withEvents.OnNotLoggedIn().Register(panicking)
+	defer func() {
+		if recover() == nil {
+			t.Fatal("the panic must be raised again")
+		}
+	}()
+	withEvents.OnNotLoggedIn().Trigger(nil, nil, "command")
+}
+
+func TestAsynchronousPanicsAreNotRaisedAgain(t *testing.T) {
+	withEvents := NewWithAuthEvents()
+	logger := &recordingLogger{}
+	withEvents.SetPanicLogger(logger)
+	withEvents.SetRepanic(true)
+	withEvents.OnNotLoggedIn().Register(panicking, WithAsyncDelivery(1, Block))
+	withEvents.OnNotLoggedIn().Trigger(nil, nil, "command")
+	withEvents.Flush()
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if len(logger.messages) != 1 {
+		t.Fatalf("the asynchronous panic must be logged: %v", logger.messages)
+	}
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A password-change logout callback. It receives the
+// attendant that changed the password and the list of
+// other attendants that were logged out because of it.
+type PasswordChangeLogoutCallback func(*chasqui.Server, *chasqui.Attendant, credentials.Credential, []*chasqui.Attendant)
+
+// Password-change logout events involve the other sessions
+// of a credential being logged out after a successful
+// password change. Callbacks can be registered to attend
+// this event.
+type PasswordChangeLogoutEvent struct {
+	Event
+}
+
+// Registers a non-null password-change logout callback.
+func (event *PasswordChangeLogoutEvent) Register(callback PasswordChangeLogoutCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return event.subscribe(callback, options)
+}
+
+// Triggers all the callbacks. Hopefully, few callbacks will be triggered.
+func (event *PasswordChangeLogoutEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kicked []*chasqui.Attendant) {
+	event.dispatch(func(callback interface{}) {
+		callback.(PasswordChangeLogoutCallback)(server, attendant, credential, kicked)
+	})
+}
@@ -0,0 +1,194 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Overflow policies tell what to do when an asynchronous
+// subscription's queue is full and a new event arrives.
+type OverflowPolicy uint8
+
+const (
+	// Blocks the triggering goroutine until there is room
+	// in the queue. No event is lost with this policy.
+	Block OverflowPolicy = iota
+
+	// Drops the oldest queued event, to make room for the
+	// new one.
+	DropOldest
+
+	// Drops the new event, keeping the queued ones.
+	DropNewest
+)
+
+// A bounded delivery queue, consumed by its own goroutine.
+// It is used by asynchronous subscriptions so a slow
+// callback does not stall the goroutine triggering the
+// event.
+type deliveryQueue struct {
+	mutex    sync.Mutex
+	changed  *sync.Cond
+	items    []func()
+	capacity int
+	policy   OverflowPolicy
+	// The queued items plus the one being run, if any.
+	pending int
+	closed  bool
+	done    chan struct{}
+	// Counters of dropped items: one for the owning
+	// subscription, and one for the owning event.
+	dropped      *uint64
+	eventDropped *uint64
+}
+
+// Creates a new delivery queue, and starts its goroutine.
+func newDeliveryQueue(capacity int, policy OverflowPolicy, dropped, eventDropped *uint64) *deliveryQueue {
+	if capacity < 1 {
+		capacity = 1
+	}
+	queue := &deliveryQueue{
+		capacity:     capacity,
+		policy:       policy,
+		done:         make(chan struct{}),
+		dropped:      dropped,
+		eventDropped: eventDropped,
+	}
+	queue.changed = sync.NewCond(&queue.mutex)
+	go queue.run()
+	return queue
+}
+
+// Counts a dropped item.
+func (queue *deliveryQueue) drop() {
+	atomic.AddUint64(queue.dropped, 1)
+	atomic.AddUint64(queue.eventDropped, 1)
+}
+
+// Adds an item to the queue, applying the overflow policy
+// if the queue is full. Items pushed to a closed queue are
+// dropped.
+func (queue *deliveryQueue) push(item func()) {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+
+	if queue.policy == Block {
+		for !queue.closed && len(queue.items) >= queue.capacity {
+			queue.changed.Wait()
+		}
+	}
+	if queue.closed {
+		queue.drop()
+		return
+	}
+	if len(queue.items) >= queue.capacity {
+		if queue.policy == DropNewest {
+			queue.drop()
+			return
+		}
+		queue.items = queue.items[1:]
+		queue.pending--
+		queue.drop()
+	}
+	queue.items = append(queue.items, item)
+	queue.pending++
+	queue.changed.Broadcast()
+}
+
+// Consumes the queue until it is closed and empty.
+func (queue *deliveryQueue) run() {
+	defer close(queue.done)
+	for {
+		queue.mutex.Lock()
+		for !queue.closed && len(queue.items) == 0 {
+			queue.changed.Wait()
+		}
+		if len(queue.items) == 0 {
+			queue.mutex.Unlock()
+			return
+		}
+		item := queue.items[0]
+		queue.items = queue.items[1:]
+		queue.changed.Broadcast()
+		queue.mutex.Unlock()
+
+		item()
+
+		queue.mutex.Lock()
+		queue.pending--
+		queue.changed.Broadcast()
+		queue.mutex.Unlock()
+	}
+}
+
+// Waits until all the queued items are delivered.
+func (queue *deliveryQueue) flush() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	for queue.pending > 0 {
+		queue.changed.Wait()
+	}
+}
+
+// Closes the queue. The already queued items will still
+// be delivered, but new ones will be dropped. This does
+// not wait for the queue to be drained.
+func (queue *deliveryQueue) close() {
+	queue.mutex.Lock()
+	defer queue.mutex.Unlock()
+	queue.closed = true
+	queue.changed.Broadcast()
+}
+
+// Waits until the queue goroutine ends. The queue must
+// be closed beforehand.
+func (queue *deliveryQueue) wait() {
+	<-queue.done
+}
+
+// A standalone asynchronous delivery queue, with the same
+// semantics of the queues of the asynchronous subscriptions.
+// It is meant for listeners that must capture the data of
+// an event while it is being dispatched (e.g. the state of
+// a session about to be removed) but process it later.
+type Queue struct {
+	queue   *deliveryQueue
+	dropped uint64
+	// Required by the delivery queue, but not exposed.
+	unused uint64
+}
+
+// Adds an item to the queue, applying the overflow policy
+// if the queue is full. Items pushed to a closed queue are
+// dropped.
+func (queue *Queue) Push(item func()) {
+	queue.queue.push(item)
+}
+
+// The number of items dropped by this queue, due to its
+// overflow policy or to being closed.
+func (queue *Queue) Dropped() uint64 {
+	return atomic.LoadUint64(&queue.dropped)
+}
+
+// Waits until all the queued items are run. This must not
+// be called from inside a queued item.
+func (queue *Queue) Flush() {
+	queue.queue.flush()
+}
+
+// Closes the queue, and waits until the already queued items
+// are run. Further items will be dropped. This must not be
+// called from inside a queued item.
+func (queue *Queue) Close() {
+	queue.queue.close()
+	queue.queue.wait()
+}
+
+// Creates a new queue of the given capacity and overflow
+// policy, and starts its goroutine.
+func NewQueue(capacity int, policy OverflowPolicy) *Queue {
+	queue := &Queue{}
+	queue.queue = newDeliveryQueue(capacity, policy, &queue.dropped, &queue.unused)
+	return queue
+}
@@ -0,0 +1,144 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/universe-10th/chasqui"
+)
+
+// Registers an async callback on a fresh event, which blocks
+// until the returned channel is closed, and records the order
+// of the delivered commands.
+func newBlockedEvent(capacity int, policy OverflowPolicy) (*NotLoggedInEvent, chan struct{}, *[]string, *sync.Mutex) {
+	event := &NotLoggedInEvent{Event{name: "not-logged-in"}}
+	release := make(chan struct{})
+	var delivered []string
+	var mutex sync.Mutex
+	event.Register(func(_ *chasqui.Server, _ *chasqui.Attendant, command string) {
+		<-release
+		mutex.Lock()
+		delivered = append(delivered, command)
+		mutex.Unlock()
+	}, WithAsyncDelivery(capacity, policy))
+	return event, release, &delivered, &mutex
+}
+
+// Triggers the first event and waits until the consumer
+// goroutine takes it (so it is no longer queued).
+func triggerAndWaitTaken(event *NotLoggedInEvent, command string) {
+	event.Trigger(nil, nil, command)
+	subscription := event.snapshot()[0]
+	for {
+		subscription.queue.mutex.Lock()
+		empty := len(subscription.queue.items) == 0
+		subscription.queue.mutex.Unlock()
+		if empty {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDropOldestKeepsTheNewestEvents(t *testing.T) {
+	event, release, delivered, mutex := newBlockedEvent(2, DropOldest)
+	triggerAndWaitTaken(event, "first")
+	for _, command := range []string{"a", "b", "c", "d"} {
+		event.Trigger(nil, nil, command)
+	}
+	close(release)
+	event.Flush()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if got := *delivered; len(got) != 3 || got[0] != "first" || got[1] != "c" || got[2] != "d" {
+		t.Fatalf("unexpected delivery: %v", got)
+	}
+	if event.Dropped() != 2 || event.snapshot()[0].Dropped() != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", event.Dropped())
+	}
+}
+
+func TestDropNewestKeepsTheOldestEvents(t *testing.T) {
+	event, release, delivered, mutex := newBlockedEvent(2, DropNewest)
+	triggerAndWaitTaken(event, "first")
+	for _, command := range []string{"a", "b", "c", "d"} {
+		event.Trigger(nil, nil, command)
+	}
+	close(release)
+	event.Flush()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if got := *delivered; len(got) != 3 || got[1] != "a" || got[2] != "b" {
+		t.Fatalf("unexpected delivery: %v", got)
+	}
+	if event.Dropped() != 2 {
+		t.Fatalf("expected 2 dropped events, got %d", event.Dropped())
+	}
+}
+
+func TestBlockLosesNothing(t *testing.T) {
+	event, release, delivered, mutex := newBlockedEvent(1, Block)
+	triggerAndWaitTaken(event, "first")
+	var triggered int32
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, command := range []string{"a", "b", "c"} {
+			event.Trigger(nil, nil, command)
+			atomic.AddInt32(&triggered, 1)
+		}
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&triggered) > 1 {
+		t.Fatal("triggering must block while the queue is full")
+	}
+	close(release)
+	<-done
+	event.Flush()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(*delivered) != 4 || event.Dropped() != 0 {
+		t.Fatalf("unexpected delivery: %v, dropped %d", *delivered, event.Dropped())
+	}
+}
+
+func TestCloseDeliversQueuedEventsAndDropsLaterOnes(t *testing.T) {
+	event, release, delivered, mutex := newBlockedEvent(4, Block)
+	event.Trigger(nil, nil, "a")
+	event.Trigger(nil, nil, "b")
+	closed := make(chan struct{})
+	go func() {
+		event.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("close must wait for the queued events")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	<-closed
+	event.Trigger(nil, nil, "late")
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(*delivered) != 2 || event.Dropped() != 1 {
+		t.Fatalf("unexpected delivery: %v, dropped %d", *delivered, event.Dropped())
+	}
+}
+
+func TestCancelDiscardsQueuedEvents(t *testing.T) {
+	event, release, delivered, mutex := newBlockedEvent(4, Block)
+	triggerAndWaitTaken(event, "first")
+	event.Trigger(nil, nil, "a")
+	subscription := event.snapshot()[0]
+	subscription.Cancel()
+	close(release)
+	subscription.queue.wait()
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(*delivered) != 1 {
+		t.Fatalf("queued events of a cancelled subscription must be discarded: %v", *delivered)
+	}
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
+)
+
+// A session resume callback. It receives the new attendant
+// the session is now bound to, and the resumed session.
+type ResumeCallback func(*chasqui.Server, *chasqui.Attendant, *types.Session)
+
+// Resume events involve a held session being bound to
+// a new attendant after a reconnection. They replace
+// the logout and login events that would otherwise be
+// triggered. Callbacks can be registered to attend this
+// event.
+type ResumeEvent struct {
+	Event
+}
+
+// Registers a non-null resume callback.
+func (event *ResumeEvent) Register(callback ResumeCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return event.subscribe(callback, options)
+}
+
+// Triggers all the callbacks. Hopefully, few callbacks will be triggered.
+func (event *ResumeEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, session *types.Session) {
+	event.dispatch(func(callback interface{}) {
+		callback.(ResumeCallback)(server, attendant, session)
+	})
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/types"
+)
+
+// A session expiration callback. It receives the attendant
+// the session was bound to (already disconnected) and the
+// session itself.
+type SessionExpiredCallback func(*chasqui.Server, *chasqui.Attendant, *types.Session)
+
+// Session expired events involve a held session not being
+// resumed within the grace period. The session is logged
+// out right after this event. Callbacks can be registered
+// to attend this event.
+type SessionExpiredEvent struct {
+	Event
+}
+
+// Registers a non-null session expiration callback.
+func (event *SessionExpiredEvent) Register(callback SessionExpiredCallback, options ...SubscriptionOption) *Subscription {
+	if callback == nil {
+		return nil
+	}
+	return event.subscribe(callback, options)
+}
+
+// Triggers all the callbacks. Hopefully, few callbacks will be triggered.
+func (event *SessionExpiredEvent) Trigger(server *chasqui.Server, attendant *chasqui.Attendant, session *types.Session) {
+	event.dispatch(func(callback interface{}) {
+		callback.(SessionExpiredCallback)(server, attendant, session)
+	})
+}
@@ -1,13 +1,35 @@
 package events
 
-// Provides the 4 events via methods:
+import "github.com/universe-10th/chasqui-identity-protocols/auth/logging"
+
+// Provides the 10 events via methods:
 // - Login attempt.
 // - Logout.
 // - Password change.
+// - Logout of other sessions after a password change.
+// - Session resume.
+// - Session ghosted.
+// - Login rejected by the domain.
+// - Authorization denied.
+// - Not-logged-in access attempt.
+// - Session expired.
+// And also the 2 veto-able hooks:
+// - Before login.
+// - Before landing.
 type WithAuthEvents struct {
-	onLogin          *LoginEvent
-	onLogout         *LogoutEvent
-	onPasswordChange *PasswordChangeEvent
+	onLogin                *LoginEvent
+	onLogout               *LogoutEvent
+	onPasswordChange       *PasswordChangeEvent
+	onPasswordChangeLogout *PasswordChangeLogoutEvent
+	onResume               *ResumeEvent
+	onGhosted              *GhostedEvent
+	onLoginRejected        *LoginRejectedEvent
+	onAuthorizationDenied  *AuthorizationDeniedEvent
+	onNotLoggedIn          *NotLoggedInEvent
+	onSessionExpired       *SessionExpiredEvent
+	onBeforeLogin          *BeforeLoginHook
+	onBeforeLanding        *BeforeLandingHook
+	panicReporter          *panicReporter
 }
 
 // Returns a reference to the login event.
@@ -25,13 +47,136 @@ func (withAuthEvents *WithAuthEvents) OnPasswordChange() *PasswordChangeEvent {
 	return withAuthEvents.onPasswordChange
 }
 
+// Returns a reference to the password change logout event.
+func (withAuthEvents *WithAuthEvents) OnPasswordChangeLogout() *PasswordChangeLogoutEvent {
+	return withAuthEvents.onPasswordChangeLogout
+}
+
+// Returns a reference to the resume event.
+func (withAuthEvents *WithAuthEvents) OnResume() *ResumeEvent {
+	return withAuthEvents.onResume
+}
+
+// Returns a reference to the session ghosted event.
+func (withAuthEvents *WithAuthEvents) OnGhosted() *GhostedEvent {
+	return withAuthEvents.onGhosted
+}
+
+// Returns a reference to the login rejected event.
+func (withAuthEvents *WithAuthEvents) OnLoginRejected() *LoginRejectedEvent {
+	return withAuthEvents.onLoginRejected
+}
+
+// Returns a reference to the authorization denied event.
+func (withAuthEvents *WithAuthEvents) OnAuthorizationDenied() *AuthorizationDeniedEvent {
+	return withAuthEvents.onAuthorizationDenied
+}
+
+// Returns a reference to the not-logged-in access event.
+func (withAuthEvents *WithAuthEvents) OnNotLoggedIn() *NotLoggedInEvent {
+	return withAuthEvents.onNotLoggedIn
+}
+
+// Returns a reference to the session expired event.
+func (withAuthEvents *WithAuthEvents) OnSessionExpired() *SessionExpiredEvent {
+	return withAuthEvents.onSessionExpired
+}
+
+// Returns a reference to the before-login hook.
+func (withAuthEvents *WithAuthEvents) OnBeforeLogin() *BeforeLoginHook {
+	return withAuthEvents.onBeforeLogin
+}
+
+// Returns a reference to the before-landing hook.
+func (withAuthEvents *WithAuthEvents) OnBeforeLanding() *BeforeLandingHook {
+	return withAuthEvents.onBeforeLanding
+}
+
+// Sets a custom handler for the panics occurring in the
+// callbacks of any event or hook. If nil, the panics will
+// be logged through the panic logger.
+func (withAuthEvents *WithAuthEvents) SetPanicHandler(handler PanicHandler) {
+	withAuthEvents.panicReporter.mutex.Lock()
+	defer withAuthEvents.panicReporter.mutex.Unlock()
+	withAuthEvents.panicReporter.handler = handler
+}
+
+// Sets the logger used to report the panics occurring in
+// the callbacks, when no custom panic handler is set. They
+// are logged with the Error level. If nil, the panics will
+// not be logged at all.
+func (withAuthEvents *WithAuthEvents) SetPanicLogger(logger logging.Logger) {
+	withAuthEvents.panicReporter.mutex.Lock()
+	defer withAuthEvents.panicReporter.mutex.Unlock()
+	withAuthEvents.panicReporter.logger = logger
+}
+
+// Tells whether the panics occurring in the callbacks must
+// be raised again, after being reported. This is intended
+// for tests, so bugs in the listeners make them fail. The
+// panics of asynchronous deliveries are never raised again,
+// since nothing could recover them in their goroutines and
+// the whole process would crash: use a panic handler to
+// catch them instead.
+func (withAuthEvents *WithAuthEvents) SetRepanic(repanic bool) {
+	withAuthEvents.panicReporter.mutex.Lock()
+	defer withAuthEvents.panicReporter.mutex.Unlock()
+	withAuthEvents.panicReporter.repanic = repanic
+}
+
+// Gets all the events and hooks.
+func (withAuthEvents *WithAuthEvents) all() []*Event {
+	return []*Event{
+		&withAuthEvents.onLogin.Event,
+		&withAuthEvents.onLogout.Event,
+		&withAuthEvents.onPasswordChange.Event,
+		&withAuthEvents.onPasswordChangeLogout.Event,
+		&withAuthEvents.onResume.Event,
+		&withAuthEvents.onGhosted.Event,
+		&withAuthEvents.onLoginRejected.Event,
+		&withAuthEvents.onAuthorizationDenied.Event,
+		&withAuthEvents.onNotLoggedIn.Event,
+		&withAuthEvents.onSessionExpired.Event,
+		&withAuthEvents.onBeforeLogin.Event,
+		&withAuthEvents.onBeforeLanding.Event,
+	}
+}
+
+// Waits until all the asynchronous subscriptions, in all
+// the events, deliver their queued events.
+func (withAuthEvents *WithAuthEvents) Flush() {
+	for _, event := range withAuthEvents.all() {
+		event.Flush()
+	}
+}
+
+// Closes the queues of all the asynchronous subscriptions,
+// in all the events, waiting for them to deliver their
+// queued events. Intended for graceful shutdown.
+func (withAuthEvents *WithAuthEvents) Close() {
+	for _, event := range withAuthEvents.all() {
+		event.Close()
+	}
+}
+
 // Creates an instance of WithAuthEvents
 // which is prepopulated with new instances
-// of the events.
+// of the events and hooks.
 func NewWithAuthEvents() WithAuthEvents {
+	reporter := newPanicReporter()
 	return WithAuthEvents{
-		onLogin:          &LoginEvent{counter: 0, callbacks: map[uint]LoginCallback{}},
-		onLogout:         &LogoutEvent{counter: 0, callbacks: map[uint]LogoutCallback{}},
-		onPasswordChange: &PasswordChangeEvent{counter: 0, callbacks: map[uint]PasswordChangeCallback{}},
+		onLogin:                &LoginEvent{Event{name: "login", reporter: reporter}},
+		onLogout:               &LogoutEvent{Event{name: "logout", reporter: reporter}},
+		onPasswordChange:       &PasswordChangeEvent{Event{name: "password-change", reporter: reporter}},
+		onPasswordChangeLogout: &PasswordChangeLogoutEvent{Event{name: "password-change-logout", reporter: reporter}},
+		onResume:               &ResumeEvent{Event{name: "resume", reporter: reporter}},
+		onGhosted:              &GhostedEvent{Event{name: "ghosted", reporter: reporter}},
+		onLoginRejected:        &LoginRejectedEvent{Event{name: "login-rejected", reporter: reporter}},
+		onAuthorizationDenied:  &AuthorizationDeniedEvent{Event{name: "authorization-denied", reporter: reporter}},
+		onNotLoggedIn:          &NotLoggedInEvent{Event{name: "not-logged-in", reporter: reporter}},
+		onSessionExpired:       &SessionExpiredEvent{Event{name: "session-expired", reporter: reporter}},
+		onBeforeLogin:          &BeforeLoginHook{Event{name: "before-login", reporter: reporter}},
+		onBeforeLanding:        &BeforeLandingHook{Event{name: "before-landing", reporter: reporter}},
+		panicReporter:          reporter,
 	}
 }
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	types2 "github.com/universe-10th/chasqui-identity-protocols/auth/types"
+	"github.com/universe-10th/identity/credentials"
+)
+
+func TestGhostedEventReceivesTheGhostedSession(t *testing.T) {
+	protocol := newTestProtocol(WithSingleGhostingDomain)
+	server, previous, next := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, previous, "alice")
+	expected := protocol.Session(previous)
+
+	var ghosted, by *chasqui.Attendant
+	var session *types2.Session
+	protocol.OnGhosted().Register(func(_ *chasqui.Server, ghostedAttendant, byAttendant *chasqui.Attendant, _ credentials.Credential, ghostedSession *types2.Session) {
+		ghosted, by, session = ghostedAttendant, byAttendant, ghostedSession
+	})
+	login(t, protocol, server, next, "alice")
+
+	if ghosted != previous || by != next {
+		t.Fatal("the event must tell the ghosted attendant and the one ghosting it")
+	}
+	if session == nil || session != expected || session.Attendant() != previous {
+		t.Fatal("the event must receive the ghosted session")
+	}
+	if protocol.Current(previous) != nil {
+		t.Fatal("the ghosted attendant must be logged out")
+	}
+}
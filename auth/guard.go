@@ -0,0 +1,59 @@
+package auth
+
+import (
+	"github.com/universe-10th/chasqui"
+	protocols "github.com/universe-10th/chasqui-protocols"
+	"github.com/universe-10th/identity/authreqs"
+	"net"
+)
+
+// A guarded protocol wraps another protocol so all its
+// handlers require authorization, except the ones in an
+// explicit allowlist of public commands. This way, a
+// forgotten handler is not silently public.
+type guardedProtocol struct {
+	protocol       protocols.Protocol
+	auth           *AuthProtocol
+	requirement    authreqs.AuthorizationRequirement
+	publicCommands map[string]bool
+}
+
+// The guarded protocol depends on the same protocols
+// the wrapped one does, and also on the auth protocol.
+func (guarded *guardedProtocol) Dependencies() protocols.Protocols {
+	dependencies := protocols.Protocols{guarded.auth: true}
+	for dependency, value := range guarded.protocol.Dependencies() {
+		dependencies[dependency] = value
+	}
+	return dependencies
+}
+
+// The handlers of the wrapped protocol, requiring the
+// default requirement except for the public commands.
+func (guarded *guardedProtocol) Handlers() protocols.MessageHandlers {
+	return guarded.auth.RequireAuthorizationWhere(guarded.requirement, guarded.protocol.Handlers(), func(command string) bool {
+		return !guarded.publicCommands[command]
+	})
+}
+
+// Forwarded to the wrapped protocol.
+func (guarded *guardedProtocol) Started(server *chasqui.Server, addr *net.TCPAddr) {
+	guarded.protocol.Started(server, addr)
+}
+
+// Forwarded to the wrapped protocol.
+func (guarded *guardedProtocol) AttendantStarted(server *chasqui.Server, attendant *chasqui.Attendant) {
+	guarded.protocol.AttendantStarted(server, attendant)
+}
+
+// Forwarded to the wrapped protocol.
+func (guarded *guardedProtocol) AttendantStopped(server *chasqui.Server, attendant *chasqui.Attendant, stopType chasqui.AttendantStopType, err error) {
+	guarded.protocol.AttendantStopped(server, attendant, stopType, err)
+}
+
+// Forwarded to the wrapped protocol.
+func (guarded *guardedProtocol) Stopped(server *chasqui.Server) {
+	guarded.protocol.Stopped(server)
+}
+
+var _ protocols.Protocol = &guardedProtocol{}
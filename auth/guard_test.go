@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
+	protocols "github.com/universe-10th/chasqui-protocols"
+	"github.com/universe-10th/chasqui/types"
+)
+
+// A protocol whose handlers count their runs.
+type countingProtocol struct {
+	runs map[string]int
+}
+
+func (protocol *countingProtocol) Dependencies() protocols.Protocols {
+	return nil
+}
+
+func (protocol *countingProtocol) Handlers() protocols.MessageHandlers {
+	handlers := protocols.MessageHandlers{}
+	for _, command := range []string{"chat.say", "chat.join", "chat.help"} {
+		command := command
+		handlers[command] = func(*chasqui.Server, *chasqui.Attendant, types.Message) {
+			protocol.runs[command]++
+		}
+	}
+	return handlers
+}
+
+func (protocol *countingProtocol) Started(*chasqui.Server, *net.TCPAddr) {}
+
+func (protocol *countingProtocol) AttendantStarted(*chasqui.Server, *chasqui.Attendant) {}
+
+func (protocol *countingProtocol) AttendantStopped(*chasqui.Server, *chasqui.Attendant, chasqui.AttendantStopType, error) {
+}
+
+func (protocol *countingProtocol) Stopped(*chasqui.Server) {}
+
+// A logger keeping its entries, by message.
+type recordingLogger struct {
+	mutex   sync.Mutex
+	entries map[string][]logging.Field
+	levels  map[string]logging.Level
+}
+
+func (logger *recordingLogger) Log(level logging.Level, message string, fields ...logging.Field) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	logger.entries[message] = fields
+	logger.levels[message] = level
+}
+
+// Tells the value of a field of the entry having the given
+// message and level, and whether it was found.
+func (logger *recordingLogger) field(level logging.Level, message, key string) (interface{}, bool) {
+	logger.mutex.Lock()
+	defer logger.mutex.Unlock()
+	if fields, ok := logger.entries[message]; ok && logger.levels[message] == level {
+		for _, field := range fields {
+			if field.Key == key {
+				return field.Value, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Invokes all the given commands of a guarded protocol.
+func invokeGuarded(t *testing.T, guarded protocols.Protocol, server *chasqui.Server, attendant *chasqui.Attendant, commands ...string) {
+	handlers := guarded.Handlers()
+	for _, command := range commands {
+		harness.Invoke(t, handlers, server, attendant, command)
+	}
+}
+
+func TestGuardRequiresLoginExceptForPublicCommands(t *testing.T) {
+	logger := &recordingLogger{entries: map[string][]logging.Field{}, levels: map[string]logging.Level{}}
+	protocol := newTestProtocol(WithLogger(logger))
+	wrapped := &countingProtocol{runs: map[string]int{}}
+	guarded := protocol.Guard(wrapped, authz.InRealm("main"), "chat.help", "chat.typo")
+	if !guarded.Dependencies()[protocol] {
+		t.Fatal("the guarded protocol must depend on the auth protocol")
+	}
+
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	invokeGuarded(t, guarded, server, attendant, "chat.say", "chat.join", "chat.help")
+	if wrapped.runs["chat.say"] != 0 || wrapped.runs["chat.join"] != 0 {
+		t.Fatalf("guarded commands must require login: %v", wrapped.runs)
+	}
+	if wrapped.runs["chat.help"] != 1 {
+		t.Fatalf("public commands must not require login: %v", wrapped.runs)
+	}
+
+	login(t, protocol, server, attendant, "alice")
+	invokeGuarded(t, guarded, server, attendant, "chat.say", "chat.join", "chat.help")
+	if wrapped.runs["chat.say"] != 1 || wrapped.runs["chat.join"] != 1 || wrapped.runs["chat.help"] != 2 {
+		t.Fatalf("every command must run after login: %v", wrapped.runs)
+	}
+
+	if commands, _ := logger.field(logging.Info, "guarded protocol public commands", "commands"); commands != "chat.help" {
+		t.Fatalf("the public commands must be logged, got %v", commands)
+	}
+	if count, _ := logger.field(logging.Info, "guarded protocol public commands", "guarded"); count != 2 {
+		t.Fatalf("the count of guarded commands must be logged, got %v", count)
+	}
+	if missing, _ := logger.field(logging.Warn, "guarded protocol lacks public commands", "commands"); missing != "chat.typo" {
+		t.Fatalf("the missing public commands must be warned about, got %v", missing)
+	}
+}
+
+func TestGuardEnforcesTheDefaultRequirement(t *testing.T) {
+	protocol := newTestProtocol()
+	wrapped := &countingProtocol{runs: map[string]int{}}
+	guarded := protocol.Guard(wrapped, authz.InRealm("admin"), "chat.help")
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	invokeGuarded(t, guarded, server, attendant, "chat.say", "chat.help")
+	if wrapped.runs["chat.say"] != 0 {
+		t.Fatal("the default requirement must be enforced on guarded commands")
+	}
+	if wrapped.runs["chat.help"] != 1 {
+		t.Fatal("the default requirement must not be enforced on public commands")
+	}
+}
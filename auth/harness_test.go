@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	protocols "github.com/universe-10th/chasqui-protocols"
+	realms2 "github.com/universe-10th/identity/realms"
+)
+
+// Creates a protocol with a single "main" realm.
+func newTestProtocol(options ...AuthOption) *AuthProtocol {
+	return NewAuthProtocol(map[string]*realms2.Realm{"main": harness.NewRealm()}, options...)
+}
+
+// Invokes a handler of the protocol by its unprefixed command.
+func invoke(t *testing.T, protocol *AuthProtocol, handlers protocols.MessageHandlers,
+	server *chasqui.Server, attendant *chasqui.Attendant, command string, args ...interface{}) {
+	harness.Invoke(t, handlers, server, attendant, protocol.prefix+command, args...)
+}
+
+// Logs a sample user in (its password is the name plus "1").
+func login(t *testing.T, protocol *AuthProtocol, server *chasqui.Server, attendant *chasqui.Attendant, user string) {
+	invoke(t, protocol, protocol.Handlers(), server, attendant, "login", user, user+"1", "main")
+	if protocol.Current(attendant) == nil {
+		t.Fatalf("%s could not log in", user)
+	}
+}
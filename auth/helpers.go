@@ -1,36 +1,248 @@
 package auth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/policy"
 	types2 "github.com/universe-10th/chasqui-identity-protocols/auth/types"
 	protocols "github.com/universe-10th/chasqui-protocols"
 	"github.com/universe-10th/chasqui/types"
 	"github.com/universe-10th/identity/authreqs"
 	"github.com/universe-10th/identity/credentials"
+	"github.com/universe-10th/identity/credentials/traits/identified"
+	"github.com/universe-10th/identity/credentials/traits/indexed"
+	"reflect"
+	"sort"
+	"sync/atomic"
+	"time"
 )
 
 // Sends an error message to the client socket.
 func (authProtocol *AuthProtocol) sendInvalidFormat(command, detail string, attendant *chasqui.Attendant) error {
+	authProtocol.log(logging.Debug, "invalid format", logging.F("command", command), logging.F("detail", detail))
 	return attendant.Send(authProtocol.prefix+"invalid", types.Args{command, detail}, nil)
 }
 
-// Ensures both callbacks to be non-nil, using the
+// Logs an entry in the protocol logger, redacting the
+// secret fields beforehand.
+func (authProtocol *AuthProtocol) log(level logging.Level, message string, fields ...logging.Field) {
+	authProtocol.logger.Log(level, message, logging.Redact(fields)...)
+}
+
+// Prepends the session id and realm of an attendant
+// (if it has a session) to the given log fields.
+func (authProtocol *AuthProtocol) sessionFields(attendant *chasqui.Attendant, fields ...logging.Field) []logging.Field {
+	if session := authProtocol.getSession(attendant); session != nil {
+		return append([]logging.Field{
+			logging.F("session", session.ID()), logging.F("realm", session.RealmKey()),
+		}, fields...)
+	}
+	return fields
+}
+
+// Tests a requirement against the credential of an
+// attendant. Realm-aware requirements are given the
+// realm key the attendant landed through, and message
+// aware requirements are given the attendant and the
+// message being handled.
+func (authProtocol *AuthProtocol) satisfies(attendant *chasqui.Attendant, credential credentials.Credential,
+	requirement authreqs.AuthorizationRequirement, message types.Message) bool {
+	realmKey := ""
+	if qualifiedKey := authProtocol.getQualifiedKey(attendant, false); qualifiedKey != nil {
+		realmKey = qualifiedKey.RealmKey()
+	}
+	return authz.SatisfiedFor(requirement, credential, realmKey, attendant, message)
+}
+
+// Tells which policy rule denies the command to the
+// attendant, if any (and if there is a policy engine).
+func (authProtocol *AuthProtocol) policyDenial(attendant *chasqui.Attendant, credential credentials.Credential,
+	command string) *policy.Denial {
+	if authProtocol.policy == nil {
+		return nil
+	}
+	var identifier interface{}
+	realmKey := ""
+	if qualifiedKey := authProtocol.getQualifiedKey(attendant, false); qualifiedKey != nil {
+		identifier, realmKey = qualifiedKey.Key(), qualifiedKey.RealmKey()
+	}
+	return authProtocol.policy.Decide(credential, identifier, realmKey, command)
+}
+
+// Takes a token from the rate limit bucket of the
+// attendant's credential. Returns whether there was
+// a token (or there are no rate limits).
+func (authProtocol *AuthProtocol) withinRateLimit(attendant *chasqui.Attendant, credential credentials.Credential) bool {
+	if authProtocol.rateLimits == nil {
+		return true
+	}
+	qualifiedKey := authProtocol.getQualifiedKey(attendant, false)
+	if qualifiedKey == nil {
+		return true
+	}
+	limit := authProtocol.rateLimits.For(credential, qualifiedKey.RealmKey())
+	return authProtocol.rateLimiter.Allow(*qualifiedKey, limit)
+}
+
+// The key of a requirement which is not comparable (e.g.
+// a slice or a map), by its type and its data pointer.
+type requirementKey struct {
+	kind    reflect.Type
+	pointer uintptr
+	length  int
+}
+
+// Tells whether a value can be used as a map key without
+// panicking (i.e. it is deeply comparable).
+func isComparable(value interface{}) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+	_ = map[interface{}]bool{}[value]
+	return true
+}
+
+// Tells the key to cache the decisions of a requirement
+// under: the requirement itself when comparable, or its
+// data pointer when it is a slice or a map. Otherwise,
+// its decisions cannot be cached, and nil is returned.
+func decisionKey(requirement authreqs.AuthorizationRequirement) interface{} {
+	if isComparable(requirement) {
+		return requirement
+	}
+	value := reflect.ValueOf(requirement)
+	switch value.Kind() {
+	case reflect.Slice:
+		return requirementKey{value.Type(), value.Pointer(), value.Len()}
+	case reflect.Map:
+		return requirementKey{value.Type(), value.Pointer(), 0}
+	default:
+		return nil
+	}
+}
+
+// Like satisfies, but remembering the decision in the
+// attendant's session, under the given decision key, if
+// any (i.e. the requirement is cacheable).
+func (authProtocol *AuthProtocol) cachedSatisfies(key interface{}, attendant *chasqui.Attendant, credential credentials.Credential,
+	requirement authreqs.AuthorizationRequirement, message types.Message) bool {
+	if key == nil {
+		return authProtocol.satisfies(attendant, credential, requirement, message)
+	}
+	session := authProtocol.getSession(attendant)
+	if session == nil {
+		return authProtocol.satisfies(attendant, credential, requirement, message)
+	}
+	if decision, ok := session.Decision(key); ok {
+		atomic.AddUint64(&authProtocol.authorizationCacheHits, 1)
+		if authProtocol.metrics != nil {
+			authProtocol.metrics.AuthorizationCacheLookup(true)
+		}
+		return decision
+	}
+	atomic.AddUint64(&authProtocol.authorizationCacheMisses, 1)
+	if authProtocol.metrics != nil {
+		authProtocol.metrics.AuthorizationCacheLookup(false)
+	}
+	decision := authProtocol.satisfies(attendant, credential, requirement, message)
+	session.SetDecision(key, decision)
+	return decision
+}
+
+// Lists the sorted keys of the realms that are visible
+// to the clients.
+func (authProtocol *AuthProtocol) visibleRealms() types.Args {
+	keys := make([]string, 0, len(authProtocol.realms))
+	for key := range authProtocol.realms {
+		if authProtocol.realmVisibility == nil || authProtocol.realmVisibility(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	list := make(types.Args, len(keys))
+	for index, key := range keys {
+		list[index] = key
+	}
+	return list
+}
+
+// Ensures all the callbacks to be non-nil, using the
 // default callbacks to replace them, per-case.
-func (authProtocol *AuthProtocol) ensureCallbacks(notLoggedIn, permissionDenied protocols.MessageHandler) (protocols.MessageHandler, protocols.MessageHandler) {
+func (authProtocol *AuthProtocol) ensureCallbacks(notLoggedIn, permissionDenied, throttled protocols.MessageHandler) (protocols.MessageHandler, protocols.MessageHandler, protocols.MessageHandler) {
 	if notLoggedIn == nil {
 		notLoggedIn = authProtocol.notLoggedInHandler
 	}
 	if permissionDenied == nil {
 		permissionDenied = authProtocol.permissionDeniedHandler
 	}
-	return notLoggedIn, permissionDenied
+	if throttled == nil {
+		throttled = authProtocol.throttledHandler
+	}
+	return notLoggedIn, permissionDenied, throttled
+}
+
+// Gets a context value of an attendant. Context accesses
+// are serialized, since held sessions are expired (and
+// so, their attendants' contexts are changed) from timer
+// goroutines, while the server goroutines may also be
+// accessing them (e.g. to resume or revoke them).
+func (authProtocol *AuthProtocol) contextValue(attendant *chasqui.Attendant, key string) (interface{}, bool) {
+	authProtocol.contextMutex.Lock()
+	defer authProtocol.contextMutex.Unlock()
+	return attendant.Context(key)
+}
+
+// Sets a context value of an attendant.
+func (authProtocol *AuthProtocol) setContextValue(attendant *chasqui.Attendant, key string, value interface{}) {
+	authProtocol.contextMutex.Lock()
+	defer authProtocol.contextMutex.Unlock()
+	attendant.SetContext(key, value)
+}
+
+// Removes a context value of an attendant.
+func (authProtocol *AuthProtocol) removeContextValue(attendant *chasqui.Attendant, key string) {
+	authProtocol.contextMutex.Lock()
+	defer authProtocol.contextMutex.Unlock()
+	attendant.RemoveContext(key)
+}
+
+// Claims the logout of an attendant: returns its credential
+// if it is logged in and no other logout is running for it.
+// Otherwise, returns nil. The claim must be released when
+// the logout ends.
+func (authProtocol *AuthProtocol) claimLogout(attendant *chasqui.Attendant) credentials.Credential {
+	authProtocol.contextMutex.Lock()
+	defer authProtocol.contextMutex.Unlock()
+	if authProtocol.loggingOut[attendant] {
+		return nil
+	}
+	if value, ok := attendant.Context(authProtocol.currentUserContextKey); ok {
+		if credential, ok := value.(credentials.Credential); ok && credential != nil {
+			authProtocol.loggingOut[attendant] = true
+			return credential
+		}
+	}
+	return nil
+}
+
+// Releases the logout claim of an attendant.
+func (authProtocol *AuthProtocol) releaseLogout(attendant *chasqui.Attendant) {
+	authProtocol.contextMutex.Lock()
+	defer authProtocol.contextMutex.Unlock()
+	delete(authProtocol.loggingOut, attendant)
 }
 
 // Gets the current credential in a given attendant.
 // Returns nil if the current user context key does
 // not have any credential for that socket.
 func (authProtocol *AuthProtocol) getCredential(attendant *chasqui.Attendant) credentials.Credential {
-	if value, ok := attendant.Context(authProtocol.currentUserContextKey); !ok {
+	if value, ok := authProtocol.contextValue(attendant, authProtocol.currentUserContextKey); !ok {
 		return nil
 	} else if credential, ok := value.(credentials.Credential); !ok {
 		return nil
@@ -41,21 +253,24 @@ func (authProtocol *AuthProtocol) getCredential(attendant *chasqui.Attendant) cr
 
 // Removes the current credential from a given attendant.
 func (authProtocol *AuthProtocol) removeCredential(attendant *chasqui.Attendant) {
-	attendant.RemoveContext(authProtocol.currentUserContextKey)
+	authProtocol.removeContextValue(attendant, authProtocol.currentUserContextKey)
 }
 
 // Sets the current credential in a given attendant.
 func (authProtocol *AuthProtocol) setCredential(attendant *chasqui.Attendant, credential credentials.Credential) {
-	attendant.SetContext(authProtocol.currentUserContextKey, credential)
+	authProtocol.setContextValue(attendant, authProtocol.currentUserContextKey, credential)
 }
 
 // Sets the qualified key for this attendant in their domain.
 func (authProtocol *AuthProtocol) setQualifiedKey(attendant *chasqui.Attendant, key *types2.QualifiedKey) {
-	attendant.SetContext(authProtocol.currentQualifiedKeyContextKey, key)
+	authProtocol.setContextValue(attendant, authProtocol.currentQualifiedKeyContextKey, key)
 }
 
-// Removes, and returns, the qualified key for this attendant.
+// Returns, and optionally removes, the qualified key for
+// this attendant.
 func (authProtocol *AuthProtocol) getQualifiedKey(attendant *chasqui.Attendant, pop bool) *types2.QualifiedKey {
+	authProtocol.contextMutex.Lock()
+	defer authProtocol.contextMutex.Unlock()
 	if key, ok := attendant.Context(authProtocol.currentQualifiedKeyContextKey); ok {
 		if key, ok := key.(*types2.QualifiedKey); ok {
 			if pop {
@@ -67,17 +282,215 @@ func (authProtocol *AuthProtocol) getQualifiedKey(attendant *chasqui.Attendant,
 	return nil
 }
 
+// Gets the current session in a given attendant.
+// Returns nil if the attendant is not logged in.
+func (authProtocol *AuthProtocol) getSession(attendant *chasqui.Attendant) *types2.Session {
+	if value, ok := authProtocol.contextValue(attendant, authProtocol.currentSessionContextKey); !ok {
+		return nil
+	} else if session, ok := value.(*types2.Session); !ok {
+		return nil
+	} else {
+		return session
+	}
+}
+
+// Sets the current session in a given attendant.
+func (authProtocol *AuthProtocol) setSession(attendant *chasqui.Attendant, session *types2.Session) {
+	authProtocol.setContextValue(attendant, authProtocol.currentSessionContextKey, session)
+}
+
+// Removes the current session from a given attendant.
+func (authProtocol *AuthProtocol) removeSession(attendant *chasqui.Attendant) {
+	authProtocol.removeContextValue(attendant, authProtocol.currentSessionContextKey)
+}
+
+// Tells the remote address of an attendant, through the
+// resolver, or "" if there is no resolver.
+func (authProtocol *AuthProtocol) remoteAddress(attendant *chasqui.Attendant) string {
+	if authProtocol.remoteAddressResolver != nil {
+		return authProtocol.remoteAddressResolver(attendant)
+	}
+	return ""
+}
+
+// Creates a new session record for an attendant that has
+// just landed with a given unified key and login identifier.
+func (authProtocol *AuthProtocol) newSession(id string, server *chasqui.Server, attendant *chasqui.Attendant,
+	key *types2.QualifiedKey, identifier interface{}, realmKey, device string) *types2.Session {
+	return types2.NewSession(id, key, server, attendant, identifier, authProtocol.remoteAddress(attendant), realmKey, device)
+}
+
+// Gets all the sessions, in a given server, having the
+// given qualified key.
+func (authProtocol *AuthProtocol) sessionsByKey(server *chasqui.Server, key types2.QualifiedKey) []*types2.Session {
+	var sessions []*types2.Session
+	for _, attendant := range authProtocol.domain.Attendants(server, key) {
+		// The attendant's session must be the one landed with
+		// the key, and not a newer one of another credential.
+		if session := authProtocol.getSession(attendant); session != nil && session.Key() != nil && session.Key().Equals(key) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions
+}
+
+// Revokes (i.e. logs out) one of the sessions sharing the
+// qualified key of the given attendant, by its session id.
+// The revoked session may be the attendant's current one.
+func (authProtocol *AuthProtocol) revokeSession(server *chasqui.Server, attendant *chasqui.Attendant, sessionID string) error {
+	if qualifiedKey := authProtocol.getQualifiedKey(attendant, false); qualifiedKey == nil {
+		return ErrMissingUnifiedKey
+	} else {
+		for _, session := range authProtocol.sessionsByKey(server, *qualifiedKey) {
+			if session.ID() == sessionID {
+				authProtocol.Logout(server, session.Attendant(), events.Forced, "revoked")
+				_ = attendant.Send(authProtocol.prefix+"sessions.revoke.success", types.Args{sessionID}, nil)
+				return nil
+			}
+		}
+		return ErrUnknownSession
+	}
+}
+
+// Logs out all the sessions, in a given server, having the
+// given qualified key, except the one of the given attendant.
+// The logout kind will be Forced, with the given reason.
+// Returns the attendants that were logged out.
+func (authProtocol *AuthProtocol) logoutOthers(server *chasqui.Server, attendant *chasqui.Attendant, key types2.QualifiedKey, reason string) []*chasqui.Attendant {
+	var kicked []*chasqui.Attendant
+	for _, other := range authProtocol.domain.Attendants(server, key) {
+		if other != attendant {
+			authProtocol.Logout(server, other, events.Forced, reason)
+			kicked = append(kicked, other)
+		}
+	}
+	return kicked
+}
+
+// Logs out all the sessions, in a given server, having the
+// given qualified key, with the given logout kind and reason.
+// Returns the number of sessions that were logged out.
+func (authProtocol *AuthProtocol) logoutAll(server *chasqui.Server, key types2.QualifiedKey, kind events.LogoutKind, reason string) int {
+	attendants := authProtocol.domain.Attendants(server, key)
+	for _, attendant := range attendants {
+		authProtocol.Logout(server, attendant, kind, reason)
+	}
+	return len(attendants)
+}
+
+// Reloads, from its realm, the credential of the given
+// attendant if it was loaded longer than the refresh
+// interval ago (and it is not backing off a previous
+// failure). Returns the credential to use: the new one,
+// or the current one if no refresh was needed. If the
+// credential no longer exists in its realm, all its
+// sessions in the server are logged out and nil is
+// returned. On other (i.e. transient) errors, the current
+// credential is kept, and the refresh is retried after
+// an exponential back-off, capped by the interval.
+func (authProtocol *AuthProtocol) refreshIfDue(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential) credentials.Credential {
+	session := authProtocol.getSession(attendant)
+	if session == nil || time.Since(session.CredentialLoaded()) < authProtocol.credentialRefreshInterval ||
+		time.Now().Before(session.RefreshRetryAt()) {
+		return credential
+	}
+	key := *session.Key()
+	switch err := authProtocol.RefreshCredential(server, key); err {
+	case nil:
+		return authProtocol.getCredential(attendant)
+	case ErrCredentialNotFound:
+		authProtocol.log(logging.Warn, "credential no longer exists", authProtocol.sessionFields(attendant)...)
+		authProtocol.logoutAll(server, key, events.Forced, "credential-not-found")
+		return nil
+	default:
+		backoff := session.RefreshFailed(minimumRefreshBackoff, authProtocol.credentialRefreshInterval)
+		authProtocol.log(logging.Error, "credential refresh failed", authProtocol.sessionFields(attendant,
+			logging.F("error", err), logging.F("retry-in", backoff.String()))...)
+		return credential
+	}
+}
+
+// The first back-off after a failed credential refresh.
+// It doubles on each consecutive failure.
+const minimumRefreshBackoff = time.Second
+
+// Loads again a credential, from its realm, according to
+// its qualified key. The same lookup criteria used to build
+// the key is used: by identification, by index, or by the
+// identifier used on login.
+func reloadCredential(credential credentials.Credential, key types2.QualifiedKey) (credentials.Credential, error) {
+	var reloaded credentials.Credential
+	var err error
+	if _, ok := credential.(identified.Identified); ok {
+		reloaded, err = key.Realm().ByIdentifier(key.Key())
+	} else if _, ok := credential.(indexed.Indexed); ok {
+		reloaded, err = key.Realm().ByIndex(key.Key())
+	} else {
+		reloaded, err = key.Realm().ByIdentifier(key.Key())
+	}
+	if err != nil {
+		return nil, err
+	} else if reloaded == nil {
+		return nil, ErrCredentialNotFound
+	}
+	return reloaded, nil
+}
+
+// Generates a random hexadecimal token of the given
+// length (in bytes, before being hex-encoded).
+func randomToken(length int) (string, error) {
+	buffer := make([]byte, length)
+	if _, err := rand.Read(buffer); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buffer), nil
+}
+
+// Wraps a handler of the protocol's own commands. They
+// only require login, and are never throttled, so a user
+// beyond the rate limit can still log out or revoke its
+// sessions.
+func (authProtocol *AuthProtocol) ownWrap(handler protocols.MessageHandler) protocols.MessageHandler {
+	return authProtocol.fullWrap(handler, nil, nil, nil, nil, false)
+}
+
 // Fully wraps a handler inside an authorization flow,
-// involving both login and authorization requirement.
-func (authProtocol *AuthProtocol) fullWrap(handler, notLoggedIn, permissionDenied protocols.MessageHandler,
-	requirement authreqs.AuthorizationRequirement) protocols.MessageHandler {
-	notLoggedIn, permissionDenied = authProtocol.ensureCallbacks(notLoggedIn, permissionDenied)
+// involving both login and authorization requirement,
+// and also the rate limit if told to.
+func (authProtocol *AuthProtocol) fullWrap(handler, notLoggedIn, permissionDenied, throttled protocols.MessageHandler,
+	requirement authreqs.AuthorizationRequirement, rateLimited bool) protocols.MessageHandler {
+	notLoggedIn, permissionDenied, throttled = authProtocol.ensureCallbacks(notLoggedIn, permissionDenied, throttled)
+	var key interface{}
+	if requirement != nil && authProtocol.cacheAuthorization && !authz.DependsOnMessage(requirement) {
+		key = decisionKey(requirement)
+	}
 	return func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
-		if credential := authProtocol.getCredential(attendant); credential == nil {
+		credential := authProtocol.getCredential(attendant)
+		if credential != nil && authProtocol.credentialRefreshInterval > 0 {
+			credential = authProtocol.refreshIfDue(server, attendant, credential)
+		}
+		if credential == nil {
+			authProtocol.log(logging.Debug, "login required", logging.F("command", message.Command()))
+			authProtocol.OnNotLoggedIn().Trigger(server, attendant, message.Command())
 			notLoggedIn(server, attendant, message)
-		} else if requirement != nil && !requirement.SatisfiedBy(credential) {
+		} else if requirement != nil && !authProtocol.cachedSatisfies(key, attendant, credential, requirement, message) {
+			authProtocol.log(logging.Warn, "permission denied", authProtocol.sessionFields(attendant,
+				logging.F("command", message.Command()))...)
+			authProtocol.OnAuthorizationDenied().Trigger(server, attendant, credential, requirement, message.Command())
+			permissionDenied(server, attendant, message)
+		} else if denial := authProtocol.policyDenial(attendant, credential, message.Command()); denial != nil {
+			authProtocol.log(logging.Warn, "permission denied by policy", authProtocol.sessionFields(attendant,
+				logging.F("command", message.Command()), logging.F("rule", denial.Rule.Name))...)
+			authProtocol.OnAuthorizationDenied().Trigger(server, attendant, credential, denial, message.Command())
 			permissionDenied(server, attendant, message)
+		} else if rateLimited && !authProtocol.withinRateLimit(attendant, credential) {
+			authProtocol.log(logging.Warn, "command throttled", authProtocol.sessionFields(attendant,
+				logging.F("command", message.Command()))...)
+			throttled(server, attendant, message)
 		} else {
+			if session := authProtocol.getSession(attendant); session != nil {
+				session.Touch()
+			}
 			handler(server, attendant, message)
 		}
 	}
@@ -1,11 +1,13 @@
 package auth
 
 // This file describes the extra protocol hooks for the auth protocol.
-// These hooks are dumbly implemented as empty, since no tracking needs
-// to be done at these points.
+// Most of these hooks are dumbly implemented as empty, since no tracking
+// needs to be done at these points. Disconnections, however, must end
+// (or hold, if resumption is enabled) the sessions of the attendants.
 
 import (
 	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
 	"net"
 )
 
@@ -20,15 +22,28 @@ func (authProtocol *AuthProtocol) Started(server *chasqui.Server, addr *net.TCPA
 func (authProtocol *AuthProtocol) AttendantStarted(server *chasqui.Server, attendant *chasqui.Attendant) {
 }
 
-// Nothing to be done when an attendant disconnects in this protocol layer.
-// If by chance someone is tracking the logged credentials' status, this event
-// will arrive there before it arrives to this auth protocol. User will have
-// the chance to handle the issue right there.
+// When a logged attendant disconnects, its session is either held
+// for the resumption grace period (if resumption is enabled) or
+// logged out right now, with the Disconnected logout kind. Logout
+// events will arrive to other protocols' listeners at this point.
 func (authProtocol *AuthProtocol) AttendantStopped(server *chasqui.Server, attendant *chasqui.Attendant, stopType chasqui.AttendantStopType, err error) {
+	if authProtocol.getCredential(attendant) != nil {
+		if token := authProtocol.getResumeToken(attendant); authProtocol.resumptionGrace > 0 && token != "" {
+			authProtocol.holdSession(server, attendant, token)
+		} else {
+			authProtocol.Logout(server, attendant, events.Disconnected, "")
+		}
+	}
 }
 
-// Nothing to be done when a server is stopped in this protocol's funnel.
-// If by chance someone is tracking the logged credentials' status, this
-// event will arrive there before it arrives to this auth protocol. User
-// will have the chance to handle the issue right there.
-func (authProtocol *AuthProtocol) Stopped(server *chasqui.Server) {}
+// When a server is stopped, the sessions being held for it cannot
+// be resumed anymore, and so they are expired right now. Then, the
+// asynchronous event subscriptions are flushed, so their listeners
+// know everything that happened in this server. If by chance someone
+// is tracking the logged credentials' status, this event will arrive
+// there before it arrives to this auth protocol. User will have the
+// chance to handle the issue right there.
+func (authProtocol *AuthProtocol) Stopped(server *chasqui.Server) {
+	authProtocol.expireHeldSessions(server)
+	authProtocol.Flush()
+}
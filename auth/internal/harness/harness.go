@@ -0,0 +1,97 @@
+// Package harness holds the helpers shared by the tests of
+// the auth protocol and its companion packages: hand-made
+// messages, sample realms, servers and loopback attendants.
+package harness
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/samples/realms"
+	protocols "github.com/universe-10th/chasqui-protocols"
+	"github.com/universe-10th/chasqui/marshalers/json"
+	"github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/credentials"
+	realms2 "github.com/universe-10th/identity/realms"
+	"github.com/universe-10th/identity/realms/login/password"
+)
+
+// A message built by hand, to invoke handlers directly.
+type Message struct {
+	command string
+	args    types.Args
+	kwargs  types.KWArgs
+}
+
+// Creates a message with the given command and positional
+// arguments, and no keyword arguments.
+func NewMessage(command string, args ...interface{}) Message {
+	return Message{command: command, args: args, kwargs: types.KWArgs{}}
+}
+
+func (message Message) Command() string {
+	return message.command
+}
+
+func (message Message) Args() types.Args {
+	return message.args
+}
+
+func (message Message) KWArgs() types.KWArgs {
+	return message.kwargs
+}
+
+// Creates a fresh realm with the sample credentials (each
+// password is the name plus "1").
+func NewRealm() *realms2.Realm {
+	return realms2.NewRealm(
+		credentials.NewSource(realms.NewDummyBroker(realms.MakeSamples()), &realms.DummyCredential{}),
+		password.PasswordCheckingStep(0),
+	)
+}
+
+// Creates a server, only used as a key.
+func NewServer() *chasqui.Server {
+	return chasqui.NewServer(&json.JSONMessageMarshaler{}, 1024, 1, 0)
+}
+
+// Creates an attendant over a loopback connection whose
+// other end discards everything. Both ends are closed when
+// the test finishes.
+func NewAttendant(t *testing.T) *chasqui.Attendant {
+	listener, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := net.DialTCP("tcp", nil, listener.Addr().(*net.TCPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	connection, err := listener.AcceptTCP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		_, _ = io.Copy(ioutil.Discard, client)
+	}()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = connection.Close()
+	})
+	return chasqui.NewAttendant(connection, &json.JSONMessageMarshaler{}, 0, nil, nil, nil, nil)
+}
+
+// Invokes a handler by its full command name, failing the
+// test if there is no such handler.
+func Invoke(t *testing.T, handlers protocols.MessageHandlers, server *chasqui.Server,
+	attendant *chasqui.Attendant, command string, args ...interface{}) {
+	handler, ok := handlers[command]
+	if !ok {
+		t.Fatalf("unknown command: %s", command)
+	}
+	handler(server, attendant, NewMessage(command, args...))
+}
@@ -0,0 +1,121 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// The level of a log entry.
+type Level uint8
+
+const (
+	// Details, mostly useful while debugging.
+	Debug Level = iota
+	// Regular outcomes (e.g. successful logins).
+	Info
+	// Unexpected but handled outcomes (e.g. failed logins,
+	// permission denials).
+	Warn
+	// Failures of the protocol itself.
+	Error
+)
+
+// The name of the level.
+func (level Level) String() string {
+	switch level {
+	case Debug:
+		return "debug"
+	case Info:
+		return "info"
+	case Warn:
+		return "warn"
+	case Error:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// A key/value field attached to a log entry.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Creates a new field.
+func F(key string, value interface{}) Field {
+	return Field{key, value}
+}
+
+// A structured logger: entries have a level, a message
+// and key/value fields. Implementations must be safe for
+// concurrent use, since they can be used from timers.
+type Logger interface {
+	Log(level Level, message string, fields ...Field)
+}
+
+// The replacement of redacted values.
+const Redacted = "[REDACTED]"
+
+// Keys whose values must never reach a logger.
+var secretKeys = map[string]bool{
+	"password":     true,
+	"token":        true,
+	"resume-token": true,
+	"secret":       true,
+}
+
+// Returns a copy of the fields, where the values of the
+// secret keys (password, token, resume-token, secret) are
+// replaced by Redacted.
+func Redact(fields []Field) []Field {
+	redacted := make([]Field, len(fields))
+	for index, field := range fields {
+		if secretKeys[strings.ToLower(field.Key)] {
+			field.Value = Redacted
+		}
+		redacted[index] = field
+	}
+	return redacted
+}
+
+// A logger that discards everything.
+type nopLogger struct{}
+
+// Discards the entry.
+func (nopLogger) Log(Level, string, ...Field) {}
+
+// The logger used when no logger is given.
+var Nop Logger = nopLogger{}
+
+// An adapter of the standard library logger. Entries
+// below the minimum level are discarded, and the rest
+// are printed like: `[warn] message key=value ...`.
+type StdLogger struct {
+	logger   *log.Logger
+	minLevel Level
+}
+
+// Prints the entry, if its level is not below the minimum.
+func (stdLogger *StdLogger) Log(level Level, message string, fields ...Field) {
+	if level < stdLogger.minLevel {
+		return
+	}
+	builder := strings.Builder{}
+	builder.WriteString("[" + level.String() + "] " + message)
+	for _, field := range Redact(fields) {
+		builder.WriteString(fmt.Sprintf(" %s=%q", field.Key, fmt.Sprint(field.Value)))
+	}
+	stdLogger.logger.Print(builder.String())
+}
+
+// Creates an adapter of the given standard library logger,
+// discarding the entries below the given level. If the
+// logger is nil, the standard logger is used.
+func NewStdLogger(logger *log.Logger, minLevel Level) *StdLogger {
+	if logger == nil {
+		logger = log.New(log.Writer(), log.Prefix(), log.Flags())
+	}
+	return &StdLogger{logger, minLevel}
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// Logs a sample user in, and tells the kind of the logout
+// caused by the given function.
+func logoutKindOf(t *testing.T, logout func(*AuthProtocol, *chasqui.Server, *chasqui.Attendant)) events.LogoutKind {
+	protocol := newTestProtocol()
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	kind := events.LogoutKind(255)
+	protocol.OnLogout().Register(func(_ *chasqui.Server, _ *chasqui.Attendant, _ credentials.Credential, logoutKind events.LogoutKind, _ string, stage events.LogoutStage) {
+		if stage == events.After {
+			kind = logoutKind
+		}
+	})
+	logout(protocol, server, attendant)
+	if protocol.Current(attendant) != nil {
+		t.Fatal("the session must be logged out")
+	}
+	return kind
+}
+
+func TestLogoutAllIsAnAdminLogout(t *testing.T) {
+	kind := logoutKindOf(t, func(protocol *AuthProtocol, server *chasqui.Server, attendant *chasqui.Attendant) {
+		protocol.LogoutAll(server, *protocol.getQualifiedKey(attendant, false), "banned")
+	})
+	if kind != events.Admin {
+		t.Fatalf("expected an admin logout, got %s", kind)
+	}
+}
+
+func TestLogoutAllCommandIsAForcedLogout(t *testing.T) {
+	kind := logoutKindOf(t, func(protocol *AuthProtocol, server *chasqui.Server, attendant *chasqui.Attendant) {
+		invoke(t, protocol, protocol.Handlers(), server, attendant, "logout-all")
+	})
+	if kind != events.Forced {
+		t.Fatalf("expected a forced logout, got %s", kind)
+	}
+}
@@ -3,14 +3,23 @@ package auth
 import (
 	"errors"
 	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
 	types2 "github.com/universe-10th/chasqui-identity-protocols/auth/types"
 	"github.com/universe-10th/chasqui-protocols"
 	"github.com/universe-10th/chasqui/types"
 	"github.com/universe-10th/identity/realms"
+	"time"
 )
 
+// The version of the auth protocol, as reported by the
+// capabilities command.
+const ProtocolVersion = "1"
+
 var ErrRejectedByDomain = errors.New("rejected - already logged in")
 var ErrMissingUnifiedKey = errors.New("missing unified key in context")
+var ErrUnknownSession = errors.New("unknown session")
+var ErrCredentialNotFound = errors.New("credential not found in its realm")
 
 // Auth protocols do not have dependencies.
 func (authProtocol *AuthProtocol) Dependencies() protocols.Protocols {
@@ -20,50 +29,100 @@ func (authProtocol *AuthProtocol) Dependencies() protocols.Protocols {
 // Auth protocols define their own handlers, which involves a custom
 // namespace to be used.
 func (authProtocol *AuthProtocol) Handlers() protocols.MessageHandlers {
-	return protocols.MessageHandlers{
+	handlers := protocols.MessageHandlers{
 		authProtocol.prefix + "login": func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			if authProtocol.metrics != nil {
+				authProtocol.metrics.LoginStarted()
+				defer authProtocol.metrics.LoginFinished()
+			}
 			args := message.Args()
-			if len(args) != 3 {
+			device, hasDevice := message.KWArgs()["device"]
+			if authProtocol.getCredential(attendant) != nil {
+				_ = attendant.Send(authProtocol.prefix+"login.error", types.Args{"already logged in"}, nil)
+			} else if len(args) != 3 {
 				_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"login", "expected 3 args: identifier, password, realm", attendant)
+			} else if _, ok := device.(string); hasDevice && !ok {
+				_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"login", "device keyword argument must be a string", attendant)
 			} else {
 				if password, ok := args[1].(string); !ok {
 					_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"login", "password argument must be a string", attendant)
 				} else if realmKey, ok := args[2].(string); !ok {
 					_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"login", "realm argument must be a string", attendant)
 				} else if currentRealm, ok := authProtocol.realms[realmKey]; !ok {
+					authProtocol.log(logging.Warn, "realm not found", logging.F("realm", realmKey))
 					_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"login", "realm is invalid", attendant)
+				} else if err := authProtocol.OnBeforeLogin().Run(args[0], realmKey, attendant); err != nil {
+					authProtocol.log(logging.Warn, "login aborted", logging.F("identifier", args[0]),
+						logging.F("realm", realmKey), logging.F("error", err))
+					_ = attendant.Send(authProtocol.prefix+"login.error", types.Args{err.Error()}, nil)
+					authProtocol.OnLogin().Trigger(server, attendant, args[0], password, realmKey, nil, err)
 				} else if credential, err := currentRealm.Login(args[0], password); err == nil {
-					qualifiedKey := types2.NewQualifiedKey(credential, args[0], currentRealm)
+					qualifiedKey := types2.NewQualifiedKey(credential, args[0], realmKey, currentRealm)
+					if err := authProtocol.OnBeforeLanding().Run(credential, qualifiedKey, attendant); err != nil {
+						authProtocol.log(logging.Warn, "login aborted", logging.F("identifier", args[0]),
+							logging.F("realm", realmKey), logging.F("error", err))
+						_ = attendant.Send(authProtocol.prefix+"login.error", types.Args{err.Error()}, nil)
+						authProtocol.OnLogin().Trigger(server, attendant, args[0], password, realmKey, credential, err)
+						return
+					}
 					reject, ghost := authProtocol.domain.CheckLanding(credential, qualifiedKey, server, attendant)
 
-					for attendant := range ghost {
-						authProtocol.Logout(server, attendant, "ghosted", "")
+					for ghosted := range ghost {
+						if ghostedCredential := authProtocol.getCredential(ghosted); ghostedCredential != nil {
+							authProtocol.log(logging.Info, "ghosting session", authProtocol.sessionFields(ghosted,
+								logging.F("identifier", args[0]))...)
+							ghostedSession := authProtocol.getSession(ghosted)
+							authProtocol.Logout(server, ghosted, events.Ghosted, "")
+							authProtocol.OnGhosted().Trigger(server, ghosted, attendant, ghostedCredential, ghostedSession)
+						}
 					}
 
 					if reject {
+						authProtocol.log(logging.Warn, "login rejected by domain", logging.F("identifier", args[0]),
+							logging.F("realm", realmKey), logging.F("rule", authProtocol.domain.Rule().String()))
 						_ = attendant.Send(authProtocol.prefix+"login.rejected", nil, nil)
+						authProtocol.OnLoginRejected().Trigger(server, attendant, credential, qualifiedKey)
 						authProtocol.OnLogin().Trigger(server, attendant, args[0], password, realmKey, credential, ErrRejectedByDomain)
+					} else if sessionID, err := randomToken(16); err != nil {
+						authProtocol.log(logging.Error, "session id generation failed", logging.F("error", err))
+						_ = attendant.Send(authProtocol.prefix+"login.error", types.Args{"login failed: internal error"}, nil)
+						authProtocol.OnLogin().Trigger(server, attendant, args[0], password, realmKey, credential, err)
 					} else {
 						authProtocol.setCredential(attendant, credential)
 						unifiedKey := authProtocol.domain.AddSession(qualifiedKey, server, attendant)
 						authProtocol.setQualifiedKey(attendant, unifiedKey)
-						_ = attendant.Send(authProtocol.prefix+"login.success", nil, nil)
+						deviceLabel, _ := device.(string)
+						authProtocol.setSession(attendant, authProtocol.newSession(sessionID, server, attendant, unifiedKey, args[0], realmKey, deviceLabel))
+						var successArgs types.Args
+						if authProtocol.resumptionGrace > 0 {
+							if resumeToken, err := randomToken(32); err == nil {
+								authProtocol.setResumeToken(attendant, resumeToken)
+								successArgs = types.Args{resumeToken}
+							}
+						}
+						authProtocol.log(logging.Info, "login succeeded", logging.F("identifier", args[0]),
+							logging.F("realm", realmKey), logging.F("session", sessionID))
+						_ = attendant.Send(authProtocol.prefix+"login.success", successArgs, nil)
 						authProtocol.OnLogin().Trigger(server, attendant, args[0], password, realmKey, credential, nil)
 					}
 				} else {
 					message := "login failed: internal error"
+					level := logging.Error
 					if err == realms.ErrLoginFailed {
 						message = "login failed: mismatch"
+						level = logging.Warn
 					}
+					authProtocol.log(level, "login failed", logging.F("identifier", args[0]),
+						logging.F("realm", realmKey), logging.F("error", err))
 					_ = attendant.Send(authProtocol.prefix+"login.error", types.Args{message}, nil)
 					authProtocol.OnLogin().Trigger(server, attendant, args[0], password, realmKey, credential, err)
 				}
 			}
 		},
-		authProtocol.prefix + "logout": authProtocol.fullWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
-			authProtocol.Logout(server, attendant, "graceful", "")
-		}, authProtocol.notLoggedInHandler, nil, nil),
-		authProtocol.prefix + "change-password": authProtocol.fullWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+		authProtocol.prefix + "logout": authProtocol.ownWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			authProtocol.Logout(server, attendant, events.Graceful, "")
+		}),
+		authProtocol.prefix + "change-password": authProtocol.ownWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
 			args := message.Args()
 			if len(args) != 1 {
 				_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"change-password", "exactly one string argument must be supplied", attendant)
@@ -79,14 +138,111 @@ func (authProtocol *AuthProtocol) Handlers() protocols.MessageHandlers {
 					} else {
 						_ = attendant.Send(authProtocol.prefix+"change-password.success", nil, nil)
 						authProtocol.OnPasswordChange().Trigger(server, attendant, credential, nil)
+						if authProtocol.logoutOthersOnPasswordChange {
+							if kicked := authProtocol.logoutOthers(server, attendant, *unifiedKey, "password-changed"); len(kicked) > 0 {
+								authProtocol.OnPasswordChangeLogout().Trigger(server, attendant, credential, kicked)
+							}
+						}
 					}
 				} else {
 					_ = attendant.Send(authProtocol.prefix+"change-password.error", nil, nil)
 					authProtocol.OnPasswordChange().Trigger(server, attendant, credential, ErrMissingUnifiedKey)
 				}
 			}
-		}, authProtocol.notLoggedInHandler, nil, nil),
+		}),
+		authProtocol.prefix + "sessions.list": authProtocol.ownWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			var list types.Args
+			if qualifiedKey := authProtocol.getQualifiedKey(attendant, false); qualifiedKey != nil {
+				for _, session := range authProtocol.sessionsByKey(server, *qualifiedKey) {
+					list = append(list, map[string]interface{}{
+						"id":             session.ID(),
+						"login-time":     session.LoginTime().Format(time.RFC3339),
+						"last-activity":  session.LastActivity().Format(time.RFC3339),
+						"remote-address": session.RemoteAddress(),
+						"device":         session.Device(),
+						"current":        session.Attendant() == attendant,
+					})
+				}
+			}
+			_ = attendant.Send(authProtocol.prefix+"sessions.list.success", list, nil)
+		}),
+		authProtocol.prefix + "sessions.revoke": authProtocol.ownWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			args := message.Args()
+			if len(args) != 1 {
+				_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"sessions.revoke", "exactly one string argument must be supplied", attendant)
+			} else if sessionID, ok := args[0].(string); !ok {
+				_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"sessions.revoke", "exactly one string argument must be supplied", attendant)
+			} else if err := authProtocol.revokeSession(server, attendant, sessionID); err != nil {
+				_ = attendant.Send(authProtocol.prefix+"sessions.revoke.error", types.Args{err.Error()}, nil)
+			}
+		}),
+		authProtocol.prefix + "whoami": authProtocol.ownWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			info := map[string]interface{}{}
+			if qualifiedKey := authProtocol.getQualifiedKey(attendant, false); qualifiedKey != nil {
+				info["realm"] = qualifiedKey.RealmKey()
+			}
+			if session := authProtocol.getSession(attendant); session != nil {
+				info["identifier"] = session.Identifier()
+				info["session"] = session.ID()
+				info["login-time"] = session.LoginTime().Format(time.RFC3339)
+			}
+			_ = attendant.Send(authProtocol.prefix+"whoami.success", types.Args{info}, nil)
+		}),
+		authProtocol.prefix + "realms": func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			_ = attendant.Send(authProtocol.prefix+"realms.success", authProtocol.visibleRealms(), nil)
+		},
+		authProtocol.prefix + "capabilities": func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			loginMethods := types.Args{"password"}
+			if authProtocol.resumptionGrace > 0 {
+				loginMethods = append(loginMethods, "resume")
+			}
+			_ = attendant.Send(authProtocol.prefix+"capabilities.success", types.Args{map[string]interface{}{
+				"domain-rule":   authProtocol.domain.Rule().String(),
+				"login-methods": loginMethods,
+				"version":       ProtocolVersion,
+			}}, nil)
+		},
+		authProtocol.prefix + "permissions": authProtocol.ownWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			var list types.Args
+			for _, command := range authProtocol.AllowedCommands(attendant) {
+				list = append(list, command)
+			}
+			_ = attendant.Send(authProtocol.prefix+"permissions.success", list, nil)
+		}),
+		authProtocol.prefix + "logout-all": authProtocol.ownWrap(func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			if qualifiedKey := authProtocol.getQualifiedKey(attendant, false); qualifiedKey != nil {
+				authProtocol.logoutAll(server, *qualifiedKey, events.Forced, "logout-all")
+			}
+		}),
+	}
+	if authProtocol.resumptionGrace > 0 {
+		handlers[authProtocol.prefix+"resume"] = func(server *chasqui.Server, attendant *chasqui.Attendant, message types.Message) {
+			args := message.Args()
+			if len(args) != 1 {
+				_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"resume", "exactly one string argument must be supplied", attendant)
+			} else if token, ok := args[0].(string); !ok {
+				_ = authProtocol.sendInvalidFormat(authProtocol.prefix+"resume", "exactly one string argument must be supplied", attendant)
+			} else if authProtocol.getCredential(attendant) != nil {
+				_ = attendant.Send(authProtocol.prefix+"resume.error", types.Args{"already logged in"}, nil)
+			} else if newToken, session, err := authProtocol.resumeSession(server, attendant, token); errors.Is(err, ErrResumeVetoed) {
+				authProtocol.log(logging.Warn, "resume aborted", logging.F("error", err))
+				_ = attendant.Send(authProtocol.prefix+"resume.error", types.Args{err.Error()}, nil)
+			} else if err != nil {
+				_ = attendant.Send(authProtocol.prefix+"resume.error", types.Args{"invalid or expired token"}, nil)
+			} else {
+				_ = attendant.Send(authProtocol.prefix+"resume.success", types.Args{newToken, session.ID()}, nil)
+				authProtocol.OnResume().Trigger(server, attendant, session)
+			}
+		}
+	}
+	// The commands requiring login are registered, so they
+	// are listed by the permissions command.
+	for _, command := range []string{
+		"logout", "change-password", "sessions.list", "sessions.revoke", "whoami", "permissions", "logout-all",
+	} {
+		authProtocol.RegisterPermission(authProtocol.prefix+command, nil)
 	}
+	return handlers
 }
 
 var _ protocols.Protocol = &AuthProtocol{}
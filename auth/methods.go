@@ -1,28 +1,129 @@
 package auth
 
 import (
+	"fmt"
 	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
 	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
 	types2 "github.com/universe-10th/chasqui-identity-protocols/auth/types"
 	protocols "github.com/universe-10th/chasqui-protocols"
 	"github.com/universe-10th/chasqui/types"
 	"github.com/universe-10th/identity/authreqs"
 	"github.com/universe-10th/identity/credentials"
 	"github.com/universe-10th/identity/realms"
+	"sort"
+	"strings"
+	"sync/atomic"
 )
 
 // Requires authorization (login and perhaps an extra set
 // of requirements) for a message handler. Returns a new
-// wrapped message handler.
+// wrapped message handler. The command of the handler is
+// unknown, so it will not be listed by the permissions
+// command: use RequireCommand for that.
 func (authProtocol *AuthProtocol) RequireAuthorization(
 	requirement authreqs.AuthorizationRequirement,
 	handler protocols.MessageHandler, options ...FallbackOption,
 ) protocols.MessageHandler {
-	var notLoggedIn, permissionDenied protocols.MessageHandler
+	var notLoggedIn, permissionDenied, throttled protocols.MessageHandler
 	for _, option := range options {
-		notLoggedIn, permissionDenied = option(notLoggedIn, permissionDenied)
+		notLoggedIn, permissionDenied, throttled = option(notLoggedIn, permissionDenied, throttled)
 	}
-	return authProtocol.fullWrap(handler, notLoggedIn, permissionDenied, requirement)
+	return authProtocol.fullWrap(handler, notLoggedIn, permissionDenied, throttled, requirement, true)
+}
+
+// Requires authorization for a message handler, with a
+// requirement that also sees the attendant and the message
+// being handled (e.g. to check the ownership of the resource
+// the message refers to). Returns a new wrapped handler. Like
+// RequireAuthorization, it does not register the command.
+func (authProtocol *AuthProtocol) RequireAuthorizationFor(
+	requirement authz.MessageAwareRequirement,
+	handler protocols.MessageHandler, options ...FallbackOption,
+) protocols.MessageHandler {
+	return authProtocol.RequireAuthorization(requirement, handler, options...)
+}
+
+// Requires login for a message handler, and also requires
+// the credential to have landed through any of the realms
+// with the given keys. Returns a new wrapped handler. Like
+// RequireAuthorization, it does not register the command.
+func (authProtocol *AuthProtocol) RequireRealm(
+	handler protocols.MessageHandler, keys ...string,
+) protocols.MessageHandler {
+	return authProtocol.RequireAuthorization(authz.InRealms(keys...), handler)
+}
+
+// Requires authorization for the message handler of the
+// given command, also registering the requirement of the
+// command (see RegisterPermission). Any requirement (e.g.
+// a message-aware or realm one) may be given, being nil
+// when only login is required. Returns a new wrapped
+// handler.
+func (authProtocol *AuthProtocol) RequireCommand(
+	command string, requirement authreqs.AuthorizationRequirement,
+	handler protocols.MessageHandler, options ...FallbackOption,
+) protocols.MessageHandler {
+	authProtocol.RegisterPermission(command, requirement)
+	return authProtocol.RequireAuthorization(requirement, handler, options...)
+}
+
+// Registers the requirement of a command, so it is taken
+// into account by the permissions command. Commands wrapped
+// by RequireCommand or by the RequireAuthorization* methods
+// taking handler maps are registered automatically, as are
+// the commands of this protocol requiring login, but single
+// handlers wrapped by RequireAuthorization, its For variant
+// or RequireRealm must be registered by hand, since their
+// command is unknown. A nil requirement means that only
+// login is required.
+func (authProtocol *AuthProtocol) RegisterPermission(command string, requirement authreqs.AuthorizationRequirement) {
+	authProtocol.permissionsMutex.Lock()
+	defer authProtocol.permissionsMutex.Unlock()
+	authProtocol.permissions[command] = requirement
+}
+
+// Lists the registered commands the attendant may invoke,
+// sorted by name. If the attendant is not logged in, the
+// list is empty. Commands having requirements that depend
+// on the message are listed, since they may be allowed for
+// some messages.
+func (authProtocol *AuthProtocol) AllowedCommands(attendant *chasqui.Attendant) []string {
+	credential := authProtocol.getCredential(attendant)
+	if credential == nil {
+		return nil
+	}
+	authProtocol.permissionsMutex.RLock()
+	defer authProtocol.permissionsMutex.RUnlock()
+	var allowed []string
+	for command, requirement := range authProtocol.permissions {
+		if authProtocol.policyDenial(attendant, credential, command) != nil {
+			continue
+		}
+		if requirement == nil || authz.DependsOnMessage(requirement) ||
+			authProtocol.satisfies(attendant, credential, requirement, nil) {
+			allowed = append(allowed, command)
+		}
+	}
+	sort.Strings(allowed)
+	return allowed
+}
+
+// Drops the cached authorization decisions of the session
+// of an attendant, if any. This is meant to be used when
+// the permissions of a credential change by other means
+// than RefreshCredential.
+func (authProtocol *AuthProtocol) InvalidateAuthorization(attendant *chasqui.Attendant) {
+	if session := authProtocol.getSession(attendant); session != nil {
+		session.ClearDecisions()
+	}
+}
+
+// Gets the hits and misses of the authorization cache
+// so far, to tell its hit rate.
+func (authProtocol *AuthProtocol) AuthorizationCacheStats() (uint64, uint64) {
+	return atomic.LoadUint64(&authProtocol.authorizationCacheHits), atomic.LoadUint64(&authProtocol.authorizationCacheMisses)
 }
 
 // Requires authorization for the message handlers in the
@@ -35,6 +136,7 @@ func (authProtocol *AuthProtocol) RequireAuthorizationWhere(
 	newHandlers := make(protocols.MessageHandlers)
 	for key, handler := range handlers {
 		if only(key) {
+			authProtocol.RegisterPermission(key, requirement)
 			newHandlers[key] = authProtocol.RequireAuthorization(requirement, handler, options...)
 		} else {
 			newHandlers[key] = handler
@@ -52,16 +154,147 @@ func (authProtocol *AuthProtocol) RequireAuthorizationAll(
 	return authProtocol.RequireAuthorizationWhere(requirement, handlers, func(string) bool { return true }, options...)
 }
 
+// Requires authorization for all the message handlers in
+// the map, by iterating and running RequireAuthorization
+// on each handler with the requirement the table tells for
+// its command. Returns an error if the table has invalid
+// patterns or, being strict, a command matches no rule.
+func (authProtocol *AuthProtocol) RequireAuthorizationMap(
+	handlers protocols.MessageHandlers, table PermissionTable, options ...FallbackOption,
+) (protocols.MessageHandlers, error) {
+	if err := table.validate(); err != nil {
+		return nil, err
+	}
+	newHandlers := make(protocols.MessageHandlers)
+	for key, handler := range handlers {
+		requirement, ok := table.match(key)
+		if !ok {
+			if table.Strict {
+				return nil, fmt.Errorf("%w: %s", ErrUnmatchedCommand, key)
+			}
+			requirement = table.Default
+		}
+		authProtocol.RegisterPermission(key, requirement)
+		newHandlers[key] = authProtocol.RequireAuthorization(requirement, handler, options...)
+	}
+	return newHandlers, nil
+}
+
+// Wraps a protocol so all its handlers require the default
+// requirement (nil means: login only), except the given public
+// commands. The public commands are logged on construction,
+// and so are the public commands the protocol does not have
+// (which may be a typo). The returned protocol must be used
+// instead of the wrapped one.
+func (authProtocol *AuthProtocol) Guard(
+	protocol protocols.Protocol, defaultRequirement authreqs.AuthorizationRequirement, publicCommands ...string,
+) protocols.Protocol {
+	public := make(map[string]bool, len(publicCommands))
+	for _, command := range publicCommands {
+		public[command] = true
+	}
+	handlers := protocol.Handlers()
+	var exposed, missing []string
+	for command := range public {
+		if _, ok := handlers[command]; ok {
+			exposed = append(exposed, command)
+		} else {
+			missing = append(missing, command)
+		}
+	}
+	sort.Strings(exposed)
+	sort.Strings(missing)
+	authProtocol.log(logging.Info, "guarded protocol public commands",
+		logging.F("commands", strings.Join(exposed, ",")), logging.F("guarded", len(handlers)-len(exposed)))
+	if len(missing) > 0 {
+		authProtocol.log(logging.Warn, "guarded protocol lacks public commands", logging.F("commands", strings.Join(missing, ",")))
+	}
+	return &guardedProtocol{protocol, authProtocol, defaultRequirement, public}
+}
+
 // Performs a logout on certain server/attendant, with a
-// given type and an underlying reason.
-func (authProtocol *AuthProtocol) Logout(server *chasqui.Server, attendant *chasqui.Attendant, logoutType, reason string) {
-	if cred := authProtocol.getCredential(attendant); cred != nil {
-		authProtocol.OnLogout().Trigger(server, attendant, cred, events.Before)
+// given kind and an underlying reason.
+func (authProtocol *AuthProtocol) Logout(server *chasqui.Server, attendant *chasqui.Attendant, kind events.LogoutKind, reason string) {
+	if cred := authProtocol.claimLogout(attendant); cred != nil {
+		defer authProtocol.releaseLogout(attendant)
+		authProtocol.log(logging.Info, "logout", authProtocol.sessionFields(attendant,
+			logging.F("kind", kind.String()), logging.F("reason", reason))...)
+		authProtocol.OnLogout().Trigger(server, attendant, cred, kind, reason, events.Before)
 		if qualifiedKey := authProtocol.getQualifiedKey(attendant, true); qualifiedKey != nil {
 			authProtocol.domain.RemoveSession(*qualifiedKey, server, attendant)
 		}
-		_ = attendant.Send(authProtocol.prefix+"logout.success", types.Args{logoutType, reason}, nil)
-		authProtocol.OnLogout().Trigger(server, attendant, cred, events.After)
+		authProtocol.removeCredential(attendant)
+		authProtocol.removeSession(attendant)
+		authProtocol.dropHeldSession(attendant)
+		authProtocol.removeResumeToken(attendant)
+		_ = attendant.Send(authProtocol.prefix+"logout.success", types.Args{kind.String(), reason}, nil)
+		authProtocol.OnLogout().Trigger(server, attendant, cred, kind, reason, events.After)
+	}
+}
+
+// Performs a logout on all the sessions, in a given server,
+// having the given qualified key. This is meant for the
+// administrators, so the logout kind will be Admin, with
+// the given reason. Returns the number of sessions that
+// were logged out.
+func (authProtocol *AuthProtocol) LogoutAll(server *chasqui.Server, key types2.QualifiedKey, reason string) int {
+	return authProtocol.logoutAll(server, key, events.Admin, reason)
+}
+
+// Gets all the current sessions, in all the servers, for
+// the given credential, landed through the realm with the
+// given key. Credentials are matched by their qualified key,
+// so the credential must either be of an identified or an
+// indexed type. If the realm does not exist, no session is
+// returned.
+func (authProtocol *AuthProtocol) SessionsOf(credential credentials.Credential, realmKey string) []*types2.Session {
+	realm, ok := authProtocol.realms[realmKey]
+	if !ok {
+		return nil
+	}
+	credentialKey := types2.NewQualifiedKey(credential, nil, realmKey, realm)
+	if credentialKey.Key() == nil {
+		return nil
+	}
+	var sessions []*types2.Session
+	authProtocol.domain.EnumerateAll(func(server *chasqui.Server, key *types2.QualifiedKey, attendant *chasqui.Attendant) bool {
+		if credentialKey.Equals(*key) {
+			if session := authProtocol.getSession(attendant); session != nil {
+				sessions = append(sessions, session)
+			}
+		}
+		return false
+	})
+	return sessions
+}
+
+// Reloads the credential of all the sessions, in a given
+// server, having the given qualified key. The credential is
+// loaded again from the realm in the key, so changes in the
+// backing broker (e.g. permissions) apply to live sessions.
+// If no session has that key, nothing is done. Only the given
+// server is affected: when the protocol serves several ones,
+// this method must be called for each of them.
+func (authProtocol *AuthProtocol) RefreshCredential(server *chasqui.Server, key types2.QualifiedKey) error {
+	attendants := authProtocol.domain.Attendants(server, key)
+	if len(attendants) == 0 {
+		return nil
+	}
+	current := authProtocol.getCredential(attendants[0])
+	if current == nil {
+		return ErrCredentialNotFound
+	}
+	if credential, err := reloadCredential(current, key); err != nil {
+		return err
+	} else {
+		for _, attendant := range attendants {
+			authProtocol.setCredential(attendant, credential)
+			if session := authProtocol.getSession(attendant); session != nil {
+				session.MarkCredentialLoaded()
+				session.ClearDecisions()
+			}
+		}
+		return nil
 	}
 }
 
@@ -70,11 +303,22 @@ func (authProtocol *AuthProtocol) Current(attendant *chasqui.Attendant) credenti
 	return authProtocol.getCredential(attendant)
 }
 
-// Given a server, enumerates all the current sessions
-// telling their qualified key and their underlying socket.
-// If the callback returns true, the iteration will stop.
-func (authProtocol *AuthProtocol) EnumerateSessions(server *chasqui.Server, callback func(*types2.QualifiedKey, *chasqui.Attendant) bool) {
-	authProtocol.domain.Enumerate(server, callback)
+// Given a server, enumerates all the current sessions.
+// Each session tells its qualified key, its underlying
+// socket and the rest of its metadata. If the callback
+// returns true, the iteration will stop.
+func (authProtocol *AuthProtocol) EnumerateSessions(server *chasqui.Server, callback func(*types2.Session) bool) {
+	authProtocol.domain.Enumerate(server, func(key *types2.QualifiedKey, attendant *chasqui.Attendant) bool {
+		if session := authProtocol.getSession(attendant); session != nil {
+			return callback(session)
+		}
+		return false
+	})
+}
+
+// Gets the current session of an attendant, if any.
+func (authProtocol *AuthProtocol) Session(attendant *chasqui.Attendant) *types2.Session {
+	return authProtocol.getSession(attendant)
 }
 
 // Gets the count of realms in this auth protocol.
@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// Registers the listeners feeding the metrics collector.
+func (authProtocol *AuthProtocol) collectMetrics() {
+	collector := authProtocol.metrics
+	rule := authProtocol.domain.Rule().String()
+	authProtocol.OnLogin().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, identifier interface{}, password, realm string, credential credentials.Credential, err error) {
+		switch err {
+		case nil:
+			collector.LoginAttempt(realm, "success")
+			collector.SessionStarted(realm, rule)
+		case ErrRejectedByDomain:
+			collector.LoginAttempt(realm, "rejected")
+		default:
+			collector.LoginAttempt(realm, "failure")
+		}
+	})
+	authProtocol.OnLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kind events.LogoutKind, reason string, stage events.LogoutStage) {
+		if stage == events.Before {
+			collector.Logout(kind.String())
+			if session := authProtocol.getSession(attendant); session != nil {
+				collector.SessionEnded(session.RealmKey(), rule)
+			}
+		}
+	})
+	authProtocol.OnPasswordChange().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, err error) {
+		if err == nil {
+			collector.PasswordChange("success")
+		} else {
+			collector.PasswordChange("failure")
+		}
+	})
+	authProtocol.OnAuthorizationDenied().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, requirement authreqs.AuthorizationRequirement, command string) {
+		collector.AuthorizationDenied(command)
+	})
+}
@@ -0,0 +1,211 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// A pair of label values, used as key of the metrics
+// having two labels.
+type labelPair struct {
+	first  string
+	second string
+}
+
+// A collector of auth protocol metrics. It keeps counters
+// and gauges, and renders them in the Prometheus text
+// exposition format. It can be mounted as an http.Handler.
+type Collector struct {
+	mutex                sync.Mutex
+	loginAttempts        map[labelPair]uint64
+	logouts              map[string]uint64
+	passwordChanges      map[string]uint64
+	authorizationDenials map[string]uint64
+	activeSessions       map[labelPair]int64
+	pendingLogins        int64
+	cacheLookups         map[string]uint64
+}
+
+// Counts a login attempt in a realm, with an outcome
+// (e.g. "success", "failure", "rejected").
+func (collector *Collector) LoginAttempt(realm, outcome string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.loginAttempts[labelPair{realm, outcome}]++
+}
+
+// Counts a logout of a given kind.
+func (collector *Collector) Logout(kind string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.logouts[kind]++
+}
+
+// Counts a password change with an outcome.
+func (collector *Collector) PasswordChange(outcome string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.passwordChanges[outcome]++
+}
+
+// Counts an authorization denial for a command.
+func (collector *Collector) AuthorizationDenied(command string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.authorizationDenials[command]++
+}
+
+// Counts a lookup in the authorization cache, telling
+// whether it was a hit or a miss.
+func (collector *Collector) AuthorizationCacheLookup(hit bool) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	if hit {
+		collector.cacheLookups["hit"]++
+	} else {
+		collector.cacheLookups["miss"]++
+	}
+}
+
+// Adds an active session in a realm, for a domain rule.
+func (collector *Collector) SessionStarted(realm, rule string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.activeSessions[labelPair{realm, rule}]++
+}
+
+// Removes an active session in a realm, for a domain rule.
+func (collector *Collector) SessionEnded(realm, rule string) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.activeSessions[labelPair{realm, rule}]--
+}
+
+// Adds a pending (i.e. being processed) login.
+func (collector *Collector) LoginStarted() {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.pendingLogins++
+}
+
+// Removes a pending (i.e. being processed) login.
+func (collector *Collector) LoginFinished() {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	collector.pendingLogins--
+}
+
+// Escapes a label value for the text exposition format.
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// Writes the header (help and type) of a metric.
+func writeHeader(writer *bufio.Writer, name, kind, help string) {
+	_, _ = fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// Writes a single-labelled counter, sorted by label value.
+func writeCounter(writer *bufio.Writer, name, help, label string, values map[string]uint64) {
+	writeHeader(writer, name, "counter", help)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(writer, "%s{%s=\"%s\"} %d\n", name, label, escape(key), values[key])
+	}
+}
+
+// Sorts label pairs, by their first and then second value.
+func sortPairs(pairs []labelPair) {
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].first != pairs[j].first {
+			return pairs[i].first < pairs[j].first
+		}
+		return pairs[i].second < pairs[j].second
+	})
+}
+
+// Renders all the metrics, in the Prometheus text exposition
+// format, into the given writer.
+func (collector *Collector) WriteTo(output io.Writer) (int64, error) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	counter := &countingWriter{writer: output}
+	writer := bufio.NewWriter(counter)
+
+	writeHeader(writer, "chasqui_auth_login_attempts_total", "counter", "Login attempts, by realm and outcome.")
+	attempts := make([]labelPair, 0, len(collector.loginAttempts))
+	for pair := range collector.loginAttempts {
+		attempts = append(attempts, pair)
+	}
+	sortPairs(attempts)
+	for _, pair := range attempts {
+		_, _ = fmt.Fprintf(writer, "chasqui_auth_login_attempts_total{realm=\"%s\",outcome=\"%s\"} %d\n",
+			escape(pair.first), escape(pair.second), collector.loginAttempts[pair])
+	}
+
+	writeCounter(writer, "chasqui_auth_logouts_total", "Logouts, by kind.", "kind", collector.logouts)
+	writeCounter(writer, "chasqui_auth_password_changes_total", "Password changes, by outcome.", "outcome", collector.passwordChanges)
+	writeCounter(writer, "chasqui_auth_authorization_denials_total", "Authorization denials, by command.", "command", collector.authorizationDenials)
+
+	writeCounter(writer, "chasqui_auth_authorization_cache_lookups_total", "Authorization cache lookups, by result.", "result", collector.cacheLookups)
+
+	writeHeader(writer, "chasqui_auth_active_sessions", "gauge", "Active sessions, by realm and domain rule.")
+	sessions := make([]labelPair, 0, len(collector.activeSessions))
+	for pair := range collector.activeSessions {
+		sessions = append(sessions, pair)
+	}
+	sortPairs(sessions)
+	for _, pair := range sessions {
+		_, _ = fmt.Fprintf(writer, "chasqui_auth_active_sessions{realm=\"%s\",rule=\"%s\"} %d\n",
+			escape(pair.first), escape(pair.second), collector.activeSessions[pair])
+	}
+
+	writeHeader(writer, "chasqui_auth_pending_logins", "gauge", "Logins being processed.")
+	_, _ = fmt.Fprintf(writer, "chasqui_auth_pending_logins %d\n", collector.pendingLogins)
+
+	err := writer.Flush()
+	return counter.count, err
+}
+
+// Serves the metrics in the Prometheus text exposition format.
+func (collector *Collector) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = collector.WriteTo(writer)
+}
+
+// A writer that counts the written bytes.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+// Writes the bytes, counting them.
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	written, err := writer.writer.Write(data)
+	writer.count += int64(written)
+	return written, err
+}
+
+// Creates a new, empty, collector.
+func NewCollector() *Collector {
+	return &Collector{
+		loginAttempts:        map[labelPair]uint64{},
+		logouts:              map[string]uint64{},
+		passwordChanges:      map[string]uint64{},
+		authorizationDenials: map[string]uint64{},
+		activeSessions:       map[labelPair]int64{},
+		cacheLookups:         map[string]uint64{},
+	}
+}
+
+var _ http.Handler = &Collector{}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCollectorRendersTheExpositionFormat(t *testing.T) {
+	collector := NewCollector()
+	collector.LoginAttempt("main", "success")
+	collector.LoginAttempt("main", "success")
+	collector.LoginAttempt("main", "failure")
+	collector.LoginAttempt("admin", "rejected")
+	collector.Logout("graceful")
+	collector.Logout("forced")
+	collector.PasswordChange("success")
+	collector.AuthorizationDenied(`say "hi"`)
+	collector.AuthorizationDenied("back\\slash\nnew line")
+	collector.AuthorizationCacheLookup(true)
+	collector.AuthorizationCacheLookup(false)
+	collector.AuthorizationCacheLookup(true)
+	collector.SessionStarted("main", "single-locking")
+	collector.SessionStarted("main", "single-locking")
+	collector.SessionEnded("main", "single-locking")
+	collector.SessionStarted("admin", "single-locking")
+	collector.LoginStarted()
+
+	expected := `# HELP chasqui_auth_login_attempts_total Login attempts, by realm and outcome.
+# TYPE chasqui_auth_login_attempts_total counter
+chasqui_auth_login_attempts_total{realm="admin",outcome="rejected"} 1
+chasqui_auth_login_attempts_total{realm="main",outcome="failure"} 1
+chasqui_auth_login_attempts_total{realm="main",outcome="success"} 2
+# HELP chasqui_auth_logouts_total Logouts, by kind.
+# TYPE chasqui_auth_logouts_total counter
+chasqui_auth_logouts_total{kind="forced"} 1
+chasqui_auth_logouts_total{kind="graceful"} 1
+# HELP chasqui_auth_password_changes_total Password changes, by outcome.
+# TYPE chasqui_auth_password_changes_total counter
+chasqui_auth_password_changes_total{outcome="success"} 1
+# HELP chasqui_auth_authorization_denials_total Authorization denials, by command.
+# TYPE chasqui_auth_authorization_denials_total counter
+chasqui_auth_authorization_denials_total{command="back\\slash\nnew line"} 1
+chasqui_auth_authorization_denials_total{command="say \"hi\""} 1
+# HELP chasqui_auth_authorization_cache_lookups_total Authorization cache lookups, by result.
+# TYPE chasqui_auth_authorization_cache_lookups_total counter
+chasqui_auth_authorization_cache_lookups_total{result="hit"} 2
+chasqui_auth_authorization_cache_lookups_total{result="miss"} 1
+# HELP chasqui_auth_active_sessions Active sessions, by realm and domain rule.
+# TYPE chasqui_auth_active_sessions gauge
+chasqui_auth_active_sessions{realm="admin",rule="single-locking"} 1
+chasqui_auth_active_sessions{realm="main",rule="single-locking"} 1
+# HELP chasqui_auth_pending_logins Logins being processed.
+# TYPE chasqui_auth_pending_logins gauge
+chasqui_auth_pending_logins 1
+`
+	buffer := &bytes.Buffer{}
+	written, err := collector.WriteTo(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buffer.String() != expected {
+		t.Fatalf("unexpected exposition:\n%s", buffer.String())
+	}
+	if written != int64(len(expected)) {
+		t.Fatalf("expected %d written bytes, got %d", len(expected), written)
+	}
+
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); contentType != "text/plain; version=0.0.4; charset=utf-8" {
+		t.Fatalf("unexpected content type: %s", contentType)
+	}
+	if recorder.Body.String() != expected {
+		t.Fatalf("unexpected served exposition:\n%s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/metrics"
+)
+
+// Tells the exposition line of the active sessions gauge for
+// the "main" realm and the given rule, or "" if missing.
+func activeSessionsLine(t *testing.T, collector *metrics.Collector, rule string) string {
+	buffer := &bytes.Buffer{}
+	if _, err := collector.WriteTo(buffer); err != nil {
+		t.Fatal(err)
+	}
+	prefix := `chasqui_auth_active_sessions{realm="main",rule="` + rule + `"} `
+	for _, line := range strings.Split(buffer.String(), "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return strings.TrimPrefix(line, prefix)
+		}
+	}
+	return ""
+}
+
+func TestActiveSessionsGaugeGoesDownOnLogout(t *testing.T) {
+	collector := metrics.NewCollector()
+	protocol := newTestProtocol(WithMetrics(collector), WithMultipleDomain)
+	server, first, second := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, first, "alice")
+	login(t, protocol, server, second, "bob")
+	if active := activeSessionsLine(t, collector, "multiple"); active != "2" {
+		t.Fatalf("expected 2 active sessions, got %q", active)
+	}
+	invoke(t, protocol, protocol.Handlers(), server, first, "logout")
+	if active := activeSessionsLine(t, collector, "multiple"); active != "1" {
+		t.Fatalf("expected 1 active session after a logout, got %q", active)
+	}
+	protocol.AttendantStopped(server, second, chasqui.AttendantRemoteStop, nil)
+	if active := activeSessionsLine(t, collector, "multiple"); active != "0" {
+		t.Fatalf("expected no active sessions after a disconnection, got %q", active)
+	}
+}
+
+func TestActiveSessionsGaugeGoesDownOnGhosting(t *testing.T) {
+	collector := metrics.NewCollector()
+	protocol := newTestProtocol(WithMetrics(collector), WithSingleGhostingDomain)
+	server, previous, next := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, previous, "alice")
+	login(t, protocol, server, next, "alice")
+	if protocol.Current(previous) != nil {
+		t.Fatal("the previous attendant must be ghosted")
+	}
+	if active := activeSessionsLine(t, collector, "single-ghosting"); active != "1" {
+		t.Fatalf("expected 1 active session after ghosting, got %q", active)
+	}
+}
+
+func TestActiveSessionsGaugeGoesDownOnExpiry(t *testing.T) {
+	collector := metrics.NewCollector()
+	protocol := newTestProtocol(WithMetrics(collector), WithResumption(20*time.Millisecond))
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	protocol.AttendantStopped(server, attendant, chasqui.AttendantRemoteStop, nil)
+	if active := activeSessionsLine(t, collector, "single-locking"); active != "1" {
+		t.Fatalf("a held session must still be active, got %q", active)
+	}
+	eventually(t, func() bool {
+		return activeSessionsLine(t, collector, "single-locking") == "0"
+	})
+}
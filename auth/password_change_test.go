@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/identity/credentials"
+)
+
+func TestChangePasswordLogsOutTheOtherSessions(t *testing.T) {
+	protocol := newTestProtocol(WithMultipleDomain)
+	server := harness.NewServer()
+	current, first, second, stranger := harness.NewAttendant(t), harness.NewAttendant(t), harness.NewAttendant(t), harness.NewAttendant(t)
+	for _, attendant := range []*chasqui.Attendant{current, first, second} {
+		login(t, protocol, server, attendant, "alice")
+	}
+	login(t, protocol, server, stranger, "bob")
+
+	loggedOut := map[*chasqui.Attendant]string{}
+	protocol.OnLogout().Register(func(_ *chasqui.Server, attendant *chasqui.Attendant, _ credentials.Credential, kind events.LogoutKind, reason string, stage events.LogoutStage) {
+		if stage == events.After {
+			loggedOut[attendant] = kind.String() + ":" + reason
+		}
+	})
+	var kicked []*chasqui.Attendant
+	var by *chasqui.Attendant
+	protocol.OnPasswordChangeLogout().Register(func(_ *chasqui.Server, attendant *chasqui.Attendant, _ credentials.Credential, others []*chasqui.Attendant) {
+		by, kicked = attendant, others
+	})
+
+	invoke(t, protocol, protocol.Handlers(), server, current, "change-password", "alice2")
+
+	if len(loggedOut) != 2 || loggedOut[first] != "forced:password-changed" || loggedOut[second] != "forced:password-changed" {
+		t.Fatalf("unexpected logouts: %v", loggedOut)
+	}
+	if protocol.Current(current) == nil || protocol.Current(stranger) == nil {
+		t.Fatal("the current session and other credentials' sessions must be kept")
+	}
+	if by != current || len(kicked) != 2 {
+		t.Fatalf("the event must list the kicked attendants: %v by %v", kicked, by)
+	}
+	for _, attendant := range kicked {
+		if attendant != first && attendant != second {
+			t.Fatalf("unexpected kicked attendant: %v", attendant)
+		}
+	}
+}
+
+func TestChangePasswordKeepsOtherSessionsWhenDisabled(t *testing.T) {
+	protocol := newTestProtocol(WithMultipleDomain, WithLogoutOthersOnPasswordChange(false))
+	server, current, other := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, current, "alice")
+	login(t, protocol, server, other, "alice")
+	triggered := false
+	protocol.OnPasswordChangeLogout().Register(func(*chasqui.Server, *chasqui.Attendant, credentials.Credential, []*chasqui.Attendant) {
+		triggered = true
+	})
+
+	invoke(t, protocol, protocol.Handlers(), server, current, "change-password", "alice2")
+	if protocol.Current(other) == nil || triggered {
+		t.Fatal("other sessions must be kept when disabled")
+	}
+}
@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/universe-10th/identity/authreqs"
+	"path"
+	"strings"
+)
+
+var ErrUnmatchedCommand = errors.New("command matches no rule in the permission table")
+
+// A permission table tells which requirement applies
+// to each command of a set of handlers. Rules are
+// keyed by command names or glob patterns (in the
+// path.Match syntax, e.g. "chat.admin.*"), and their
+// requirement may be nil to only require login.
+//
+// When a command matches several rules, an exact
+// name wins over any pattern, and otherwise the most
+// specific pattern (the one having more literal
+// characters) wins. Commands matching no rule take
+// the Default requirement (nil means: login only),
+// unless the table is Strict, in which case they
+// are a construction error.
+type PermissionTable struct {
+	Rules   map[string]authreqs.AuthorizationRequirement
+	Default authreqs.AuthorizationRequirement
+	Strict  bool
+}
+
+// Counts the literal (i.e. non-wildcard) characters
+// of a pattern, to tell how specific it is.
+func patternSpecificity(pattern string) int {
+	specificity := 0
+	escaped := false
+	inClass := false
+	for _, char := range pattern {
+		switch {
+		case escaped:
+			escaped = false
+			specificity++
+		case char == '\\':
+			escaped = true
+		case inClass:
+			if char == ']' {
+				inClass = false
+			}
+		case char == '[':
+			inClass = true
+		case char == '*' || char == '?':
+		default:
+			specificity++
+		}
+	}
+	return specificity
+}
+
+// Validates all the patterns of the table.
+func (table PermissionTable) validate() error {
+	for pattern := range table.Rules {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Finds the rule matching a command. Returns the
+// requirement and whether a rule matched.
+func (table PermissionTable) match(command string) (authreqs.AuthorizationRequirement, bool) {
+	if requirement, ok := table.Rules[command]; ok {
+		return requirement, true
+	}
+	best := ""
+	bestSpecificity := -1
+	for pattern := range table.Rules {
+		if !strings.ContainsAny(pattern, `*?[\`) {
+			continue
+		}
+		if matched, _ := path.Match(pattern, command); matched {
+			specificity := patternSpecificity(pattern)
+			if specificity > bestSpecificity || specificity == bestSpecificity && pattern < best {
+				best, bestSpecificity = pattern, specificity
+			}
+		}
+	}
+	if bestSpecificity < 0 {
+		return nil, false
+	}
+	return table.Rules[best], true
+}
@@ -0,0 +1,115 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	protocols "github.com/universe-10th/chasqui-protocols"
+	"github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/authreqs"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// A requirement known by its name, satisfied by anyone.
+type namedRequirement string
+
+func (requirement namedRequirement) SatisfiedBy(credentials.Credential) bool {
+	return true
+}
+
+func TestPermissionTableMatchPrefersTheMostSpecificRule(t *testing.T) {
+	table := PermissionTable{Rules: map[string]authreqs.AuthorizationRequirement{
+		"chat.admin.kick": namedRequirement("exact"),
+		"chat.admin.*":    namedRequirement("admin"),
+		"chat.*":          namedRequirement("chat"),
+		"chat.?????.*":    namedRequirement("five letters"),
+		"chat.a[a-z]*":    namedRequirement("class"),
+		"chat.b*":         namedRequirement("b"),
+		"chat.*b":         namedRequirement("ends with b"),
+		"chat.open":       nil,
+	}}
+	for _, test := range []struct {
+		command  string
+		expected authreqs.AuthorizationRequirement
+		matched  bool
+	}{
+		// Exact names win over any pattern.
+		{"chat.admin.kick", namedRequirement("exact"), true},
+		{"chat.open", nil, true},
+		// More literal characters win.
+		{"chat.admin.ban", namedRequirement("admin"), true},
+		{"chat.users.list", namedRequirement("five letters"), true},
+		{"chat.say", namedRequirement("chat"), true},
+		// Classes do not count as literals, but the rest does.
+		{"chat.ax", namedRequirement("class"), true},
+		// Ties are broken by the pattern, alphabetically.
+		{"chat.bob", namedRequirement("ends with b"), true},
+		{"mail.send", nil, false},
+	} {
+		requirement, matched := table.match(test.command)
+		if requirement != test.expected || matched != test.matched {
+			t.Errorf("%s: expected %v (%v), got %v (%v)", test.command, test.expected, test.matched, requirement, matched)
+		}
+	}
+}
+
+func TestPatternSpecificityCountsLiterals(t *testing.T) {
+	for pattern, expected := range map[string]int{
+		"chat.say":     8,
+		"chat.*":       5,
+		"chat.?":       5,
+		"chat.[abc]":   5,
+		`chat.\*`:      6,
+		"*":            0,
+		`\[not.class]`: 11,
+	} {
+		if specificity := patternSpecificity(pattern); specificity != expected {
+			t.Errorf("%s: expected %d, got %d", pattern, expected, specificity)
+		}
+	}
+}
+
+func TestRequireAuthorizationMapUsesTheTable(t *testing.T) {
+	noop := func(*chasqui.Server, *chasqui.Attendant, types.Message) {}
+	handlers := protocols.MessageHandlers{"chat.say": noop, "chat.admin.kick": noop, "mail.send": noop}
+	rules := map[string]authreqs.AuthorizationRequirement{
+		"chat.*":       namedRequirement("chat"),
+		"chat.admin.*": authz.InRealm("admin"),
+	}
+
+	protocol := newTestProtocol()
+	wrapped, err := protocol.RequireAuthorizationMap(handlers, PermissionTable{Rules: rules, Default: namedRequirement("default")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(wrapped) != len(handlers) {
+		t.Fatalf("every handler must be wrapped, got %d", len(wrapped))
+	}
+	if protocol.permissions["chat.say"] != namedRequirement("chat") || protocol.permissions["mail.send"] != namedRequirement("default") {
+		t.Fatalf("unexpected registered permissions: %v", protocol.permissions)
+	}
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	denied := 0
+	wrapped, _ = protocol.RequireAuthorizationMap(handlers, PermissionTable{Rules: rules}, WithPermissionDenied(
+		func(*chasqui.Server, *chasqui.Attendant, types.Message) { denied++ },
+	))
+	for command, handler := range wrapped {
+		handler(server, attendant, harness.NewMessage(command))
+	}
+	if denied != 1 {
+		t.Fatalf("only the admin command must be denied in the main realm, got %d denials", denied)
+	}
+
+	strict := PermissionTable{Rules: rules, Strict: true}
+	if _, err := newTestProtocol().RequireAuthorizationMap(handlers, strict); !errors.Is(err, ErrUnmatchedCommand) {
+		t.Fatalf("expected ErrUnmatchedCommand, got %v", err)
+	}
+	invalid := PermissionTable{Rules: map[string]authreqs.AuthorizationRequirement{"chat.[": nil}}
+	if _, err := newTestProtocol().RequireAuthorizationMap(handlers, invalid); err == nil {
+		t.Fatal("an invalid pattern must be rejected")
+	}
+}
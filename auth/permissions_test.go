@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui/types"
+)
+
+func TestAllowedCommandsListsOwnAndRequiredCommands(t *testing.T) {
+	protocol := newTestProtocol()
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+
+	noop := func(*chasqui.Server, *chasqui.Attendant, types.Message) {}
+	protocol.RequireCommand("chat.say", nil, noop)
+	protocol.RequireCommand("chat.main", authz.InRealm("main"), noop)
+	protocol.RequireCommand("chat.admin", authz.InRealm("admin"), noop)
+	protocol.RequireAuthorization(nil, noop)
+
+	expected := []string{
+		"auth.change-password", "auth.logout", "auth.logout-all", "auth.permissions",
+		"auth.sessions.list", "auth.sessions.revoke", "auth.whoami", "chat.main", "chat.say",
+	}
+	if allowed := protocol.AllowedCommands(attendant); !reflect.DeepEqual(allowed, expected) {
+		t.Fatalf("unexpected allowed commands: %v", allowed)
+	}
+	if allowed := protocol.AllowedCommands(harness.NewAttendant(t)); len(allowed) != 0 {
+		t.Fatalf("nothing is allowed without login: %v", allowed)
+	}
+}
@@ -0,0 +1,219 @@
+package policy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/universe-10th/identity/credentials"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidEffect = errors.New("invalid effect")
+var ErrTrailingContent = errors.New("unexpected content after the policy document")
+
+// The contents of a policy file.
+type document struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// A denial tells which rule denied a command. It is
+// also an authorization requirement which is never
+// satisfied, so it can be reported wherever denied
+// requirements are reported (e.g. the authorization
+// denied event of the auth protocol).
+type Denial struct {
+	Rule Rule
+}
+
+// Never satisfied.
+func (denial *Denial) SatisfiedBy(credential credentials.Credential) bool {
+	return false
+}
+
+// A policy engine holds rules loaded from a file, and
+// decides whether commands are denied. Rules can be
+// reloaded when the file changes. Commands no rule
+// applies to are not denied by the engine.
+type Engine struct {
+	path    string
+	mutex   sync.RWMutex
+	rules   []Rule
+	modTime time.Time
+	onError func(error)
+	stop    chan struct{}
+	once    sync.Once
+	watch   sync.Once
+}
+
+// Tells whether a policy file is a YAML one, by its
+// extension (.yaml or .yml). Otherwise, it is a JSON one.
+func isYAML(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// Parses, validates and sorts the rules of a policy file,
+// being either YAML or JSON. Unknown fields are rejected
+// in both formats, so misspelled ones are not ignored.
+func parse(content []byte, yamlFormat bool) ([]Rule, error) {
+	var doc document
+	if yamlFormat {
+		if err := yaml.UnmarshalStrict(content, &doc); err != nil {
+			return nil, err
+		}
+	} else {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, err
+		} else if decoder.More() {
+			return nil, ErrTrailingContent
+		}
+	}
+	for index := range doc.Rules {
+		if err := doc.Rules[index].validate(); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(doc.Rules, func(i, j int) bool {
+		if doc.Rules[i].Priority != doc.Rules[j].Priority {
+			return doc.Rules[i].Priority > doc.Rules[j].Priority
+		}
+		return doc.Rules[i].Effect == Deny && doc.Rules[j].Effect == Allow
+	})
+	return doc.Rules, nil
+}
+
+// Loads the rules from the engine's file, replacing the
+// current ones only if the new ones are valid. Invalid
+// files are remembered as loaded anyway, so they are not
+// reloaded (and reported) again until they change.
+func (engine *Engine) Reload() error {
+	info, err := os.Stat(engine.path)
+	if err != nil {
+		return err
+	}
+	content, err := ioutil.ReadFile(engine.path)
+	if err != nil {
+		return err
+	}
+	rules, err := parse(content, isYAML(engine.path))
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+	engine.modTime = info.ModTime()
+	if err != nil {
+		return fmt.Errorf("%s: %w", engine.path, err)
+	}
+	engine.rules = rules
+	return nil
+}
+
+// Reloads the rules if the file was modified since the
+// last load. Returns whether a reload took place.
+func (engine *Engine) ReloadIfChanged() (bool, error) {
+	info, err := os.Stat(engine.path)
+	if err != nil {
+		return false, err
+	}
+	engine.mutex.RLock()
+	unchanged := info.ModTime().Equal(engine.modTime)
+	engine.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	return true, engine.Reload()
+}
+
+// Starts polling the file, each given interval, to
+// reload the rules when it changes. Errors are given
+// to the error handler, and the current rules are kept.
+// Polling stops when the engine is closed. Only the
+// first call starts polling: further calls do nothing.
+func (engine *Engine) Watch(interval time.Duration) {
+	engine.watch.Do(func() {
+		ticker := time.NewTicker(interval)
+		go func() {
+			defer ticker.Stop()
+			for {
+				select {
+				case <-engine.stop:
+					return
+				case <-ticker.C:
+					if _, err := engine.ReloadIfChanged(); err != nil && engine.onError != nil {
+						engine.onError(err)
+					}
+				}
+			}
+		}()
+	})
+}
+
+// Stops polling the file, if it was being watched.
+func (engine *Engine) Close() {
+	engine.once.Do(func() {
+		close(engine.stop)
+	})
+}
+
+// Gets a copy of the current rules, in evaluation order.
+func (engine *Engine) Rules() []Rule {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	return append([]Rule(nil), engine.rules...)
+}
+
+// Decides whether a command is denied for a credential
+// (with the key it landed with) in a realm. The first
+// matching rule decides: if it denies, the denial is
+// returned. Otherwise, nil is returned.
+func (engine *Engine) Decide(credential credentials.Credential, identifier interface{}, realmKey, command string) *Denial {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	for _, rule := range engine.rules {
+		if rule.Matches(credential, identifier, realmKey, command) {
+			if rule.Effect == Deny {
+				return &Denial{rule}
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// An option for a new policy engine.
+type EngineOption func(*Engine)
+
+// This option-maker returns an option that sets the
+// handler of the errors occurring while reloading the
+// rules on file changes.
+func WithErrorHandler(onError func(error)) EngineOption {
+	return func(engine *Engine) {
+		engine.onError = onError
+	}
+}
+
+// Creates a policy engine loading its rules from the
+// file in the given path: a YAML file if its extension
+// is .yaml or .yml, or a JSON file otherwise. Fails if
+// the rules cannot be loaded.
+func NewEngine(path string, options ...EngineOption) (*Engine, error) {
+	engine := &Engine{path: path, stop: make(chan struct{})}
+	for _, option := range options {
+		option(engine)
+	}
+	if err := engine.Reload(); err != nil {
+		return nil, err
+	}
+	return engine, nil
+}
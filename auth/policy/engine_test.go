@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const yamlRules = `
+rules:
+  - name: allow-chat
+    command: "chat.*"
+    effect: allow
+  - name: deny-admins
+    realm: admin
+    effect: deny
+    priority: 10
+`
+
+const jsonRules = `{"rules": [{"name": "deny-all", "effect": "deny"}]}`
+
+// Writes a policy file in a temporary directory, with
+// a given modification time.
+func writePolicy(t *testing.T, path, content string, modTime time.Time) {
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Creates a temporary directory, removed after the test.
+func tempDir(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(directory)
+	})
+	return directory
+}
+
+// Tells the names of the rules, in evaluation order.
+func names(engine *Engine) []string {
+	var result []string
+	for _, rule := range engine.Rules() {
+		result = append(result, rule.Name)
+	}
+	return result
+}
+
+func TestEngineLoadsYAML(t *testing.T) {
+	path := filepath.Join(tempDir(t), "policy.yaml")
+	writePolicy(t, path, yamlRules, time.Now())
+	engine, err := NewEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(engine); len(got) != 2 || got[0] != "deny-admins" || got[1] != "allow-chat" {
+		t.Fatalf("unexpected rules: %v", got)
+	}
+	if denial := engine.Decide(nil, "alice", "admin", "chat.say"); denial == nil || denial.Rule.Name != "deny-admins" {
+		t.Fatal("the admin realm must be denied")
+	}
+	if engine.Decide(nil, "alice", "main", "chat.say") != nil {
+		t.Fatal("chat must be allowed in the main realm")
+	}
+}
+
+func TestEngineRejectsUnknownYAMLFields(t *testing.T) {
+	path := filepath.Join(tempDir(t), "policy.yml")
+	writePolicy(t, path, "rules:\n  - name: typo\n    efect: deny\n", time.Now())
+	if _, err := NewEngine(path); err == nil {
+		t.Fatal("unknown fields must be rejected")
+	}
+}
+
+func TestEngineRejectsUnknownJSONFields(t *testing.T) {
+	path := filepath.Join(tempDir(t), "policy.json")
+	writePolicy(t, path, `{"rules": [{"name": "typo", "effect": "deny", "prority": 10}]}`, time.Now())
+	if _, err := NewEngine(path); err == nil {
+		t.Fatal("unknown fields must be rejected")
+	}
+	writePolicy(t, path, jsonRules+jsonRules, time.Now())
+	if _, err := NewEngine(path); !errors.Is(err, ErrTrailingContent) {
+		t.Fatalf("expected ErrTrailingContent, got %v", err)
+	}
+}
+
+func TestEngineReloadsChangedFiles(t *testing.T) {
+	path := filepath.Join(tempDir(t), "policy.json")
+	start := time.Now().Add(-time.Hour)
+	writePolicy(t, path, jsonRules, start)
+	engine, err := NewEngine(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := engine.ReloadIfChanged(); reloaded || err != nil {
+		t.Fatalf("an unchanged file must not be reloaded: %v %v", reloaded, err)
+	}
+
+	writePolicy(t, path, `{"rules": [{"name": "broken", "effect": "maybe"}]}`, start.Add(time.Minute))
+	if reloaded, err := engine.ReloadIfChanged(); !reloaded || err == nil {
+		t.Fatalf("an invalid file must be reported once: %v %v", reloaded, err)
+	}
+	if reloaded, err := engine.ReloadIfChanged(); reloaded || err != nil {
+		t.Fatalf("an invalid file must not be reported again: %v %v", reloaded, err)
+	}
+	if got := names(engine); len(got) != 1 || got[0] != "deny-all" {
+		t.Fatalf("the previous rules must be kept: %v", got)
+	}
+
+	writePolicy(t, path, `{"rules": [{"name": "allow-all", "effect": "allow"}]}`, start.Add(2*time.Minute))
+	if reloaded, err := engine.ReloadIfChanged(); !reloaded || err != nil {
+		t.Fatalf("a fixed file must be reloaded: %v %v", reloaded, err)
+	}
+	if got := names(engine); len(got) != 1 || got[0] != "allow-all" {
+		t.Fatalf("the new rules must be loaded: %v", got)
+	}
+}
+
+func TestWatchReportsEachInvalidChangeOnce(t *testing.T) {
+	path := filepath.Join(tempDir(t), "policy.json")
+	start := time.Now().Add(-time.Hour)
+	writePolicy(t, path, jsonRules, start)
+	var errors int32
+	engine, err := NewEngine(path, WithErrorHandler(func(error) {
+		atomic.AddInt32(&errors, 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer engine.Close()
+	engine.Watch(time.Millisecond)
+	engine.Watch(time.Millisecond)
+
+	writePolicy(t, path, "{", start.Add(time.Minute))
+	time.Sleep(50 * time.Millisecond)
+	if count := atomic.LoadInt32(&errors); count != 1 {
+		t.Fatalf("expected a single error, got %d", count)
+	}
+}
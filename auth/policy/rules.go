@@ -0,0 +1,104 @@
+package policy
+
+import (
+	"fmt"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
+	"github.com/universe-10th/identity/credentials"
+	"path"
+)
+
+// The effect of a rule: either allowing or denying.
+type Effect string
+
+const (
+	Allow Effect = "allow"
+	Deny  Effect = "deny"
+)
+
+// This trait makes the credential expose arbitrary
+// attributes, to be matched by the subject of the
+// policy rules.
+type Attributed interface {
+	Attribute(name string) (interface{}, bool)
+}
+
+// A policy rule. It applies to a command when its
+// subject, realm and command pattern match, and then
+// its effect decides. Empty fields match anything.
+//
+// The subject maps attribute names to the expected
+// values (or "*" to just require the attribute). The
+// "identifier" attribute is the key the credential
+// landed with, "role" and "permission" are tested
+// against the roles and permissions of authz.Privileged
+// credentials, and other attributes are taken from
+// Attributed credentials.
+//
+// The command is a pattern in the path.Match syntax.
+// Rules with higher priority are evaluated first and,
+// on ties, deny rules go first.
+type Rule struct {
+	Name     string            `json:"name" yaml:"name"`
+	Subject  map[string]string `json:"subject,omitempty" yaml:"subject,omitempty"`
+	Realm    string            `json:"realm,omitempty" yaml:"realm,omitempty"`
+	Command  string            `json:"command,omitempty" yaml:"command,omitempty"`
+	Effect   Effect            `json:"effect" yaml:"effect"`
+	Priority int               `json:"priority,omitempty" yaml:"priority,omitempty"`
+}
+
+// Validates the effect and the command pattern.
+func (rule *Rule) validate() error {
+	if rule.Effect != Allow && rule.Effect != Deny {
+		return fmt.Errorf("rule %q: %w: %q", rule.Name, ErrInvalidEffect, rule.Effect)
+	}
+	if _, err := path.Match(rule.Command, ""); err != nil {
+		return fmt.Errorf("rule %q: invalid command pattern: %w", rule.Name, err)
+	}
+	return nil
+}
+
+// Tells whether a single subject attribute matches.
+func attributeMatches(credential credentials.Credential, identifier interface{}, name, expected string) bool {
+	switch name {
+	case "identifier":
+		return identifier != nil && (expected == "*" || fmt.Sprint(identifier) == expected)
+	case "role", "permission":
+		if privileged, ok := credential.(authz.Privileged); ok {
+			granted := privileged.Roles()
+			if name == "permission" {
+				granted = privileged.Permissions()
+			}
+			if expected == "*" {
+				return len(granted) > 0
+			}
+			return granted[expected]
+		}
+		return false
+	default:
+		if attributed, ok := credential.(Attributed); ok {
+			if value, ok := attributed.Attribute(name); ok {
+				return expected == "*" || fmt.Sprint(value) == expected
+			}
+		}
+		return false
+	}
+}
+
+// Tells whether the rule applies to a credential (with
+// the key it landed with), a realm and a command.
+func (rule *Rule) Matches(credential credentials.Credential, identifier interface{}, realmKey, command string) bool {
+	if rule.Realm != "" && rule.Realm != realmKey {
+		return false
+	}
+	if rule.Command != "" {
+		if matched, _ := path.Match(rule.Command, command); !matched {
+			return false
+		}
+	}
+	for name, expected := range rule.Subject {
+		if !attributeMatches(credential, identifier, name, expected) {
+			return false
+		}
+	}
+	return true
+}
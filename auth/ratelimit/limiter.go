@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// A token-bucket limit: buckets are refilled with Rate
+// tokens per second, up to Burst tokens, and each call
+// takes one token. A limit with a non-positive rate is
+// unlimited. A Burst below 1 is taken as 1, since no
+// call could ever be allowed otherwise.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Tells whether the limit actually limits.
+func (limit Limit) Unlimited() bool {
+	return limit.Rate <= 0
+}
+
+// The maximum number of tokens of a bucket, being at
+// least 1.
+func (limit Limit) capacity() float64 {
+	if limit.Burst < 1 {
+		return 1
+	}
+	return float64(limit.Burst)
+}
+
+// The time a limit takes to refill an empty bucket.
+func (limit Limit) refillTime() time.Duration {
+	return time.Duration(limit.capacity() / limit.Rate * float64(time.Second))
+}
+
+// A bucket, keyed in a limiter.
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+// How many calls to Allow happen between prunes of the
+// refilled buckets.
+const pruneEvery = 1024
+
+// A limiter keeps a token bucket per key. Keys must be
+// comparable. Buckets which are refilled get dropped
+// from time to time, since they are the same as new.
+type Limiter struct {
+	mutex   sync.Mutex
+	buckets map[interface{}]*bucket
+	calls   int
+}
+
+// Drops the buckets which are already refilled.
+func (limiter *Limiter) prune(now time.Time) {
+	for key, current := range limiter.buckets {
+		if now.Sub(current.last) >= current.limit.refillTime() {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// Takes a token from the bucket of the key, under the
+// given limit. Returns whether there was a token. New
+// keys start with a full bucket.
+func (limiter *Limiter) Allow(key interface{}, limit Limit) bool {
+	if limit.Unlimited() {
+		return true
+	}
+	now := time.Now()
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	limiter.calls++
+	if limiter.calls%pruneEvery == 0 {
+		limiter.prune(now)
+	}
+
+	current, ok := limiter.buckets[key]
+	if !ok {
+		current = &bucket{tokens: limit.capacity(), last: now, limit: limit}
+		limiter.buckets[key] = current
+	} else {
+		current.tokens += now.Sub(current.last).Seconds() * limit.Rate
+		if current.tokens > limit.capacity() {
+			current.tokens = limit.capacity()
+		}
+		current.last = now
+		current.limit = limit
+	}
+	if current.tokens < 1 {
+		return false
+	}
+	current.tokens--
+	return true
+}
+
+// Creates a new limiter, with no buckets.
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: map[interface{}]*bucket{}}
+}
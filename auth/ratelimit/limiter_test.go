@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// Tells how many calls are allowed in a row.
+func allowedInARow(limiter *Limiter, key interface{}, limit Limit) int {
+	allowed := 0
+	for index := 0; index < 100; index++ {
+		if limiter.Allow(key, limit) {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestBucketsStartFullAndAreKeyed(t *testing.T) {
+	limiter := NewLimiter()
+	limit := Limit{Rate: 0.001, Burst: 3}
+	if allowed := allowedInARow(limiter, "alice", limit); allowed != 3 {
+		t.Fatalf("expected the burst to be allowed, got %d", allowed)
+	}
+	if allowed := allowedInARow(limiter, "bob", limit); allowed != 3 {
+		t.Fatalf("other keys must have their own bucket, got %d", allowed)
+	}
+}
+
+func TestNonPositiveBurstIsTakenAsOne(t *testing.T) {
+	for _, burst := range []int{0, -5} {
+		limiter := NewLimiter()
+		if allowed := allowedInARow(limiter, "alice", Limit{Rate: 0.001, Burst: burst}); allowed != 1 {
+			t.Fatalf("burst %d: expected a single call, got %d", burst, allowed)
+		}
+	}
+}
+
+func TestBucketsRefill(t *testing.T) {
+	limiter := NewLimiter()
+	limit := Limit{Rate: 100, Burst: 2}
+	allowedInARow(limiter, "alice", limit)
+	if limiter.Allow("alice", limit) {
+		t.Fatal("an empty bucket must throttle")
+	}
+	time.Sleep(15 * time.Millisecond)
+	if !limiter.Allow("alice", limit) {
+		t.Fatal("the bucket must be refilled over time")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if allowed := allowedInARow(limiter, "alice", limit); allowed != 2 {
+		t.Fatalf("the bucket must not be refilled beyond the burst, got %d", allowed)
+	}
+}
+
+func TestPruneDropsRefilledBuckets(t *testing.T) {
+	limiter := NewLimiter()
+	limiter.Allow("fast", Limit{Rate: 10, Burst: 1})
+	limiter.Allow("slow", Limit{Rate: 0.01, Burst: 1})
+	limiter.Allow("unlimited", Limit{})
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+	limiter.prune(time.Now().Add(time.Second))
+	if _, ok := limiter.buckets["fast"]; ok {
+		t.Fatal("a refilled bucket must be pruned")
+	}
+	if _, ok := limiter.buckets["slow"]; !ok {
+		t.Fatal("a bucket still refilling must be kept")
+	}
+	if len(limiter.buckets) != 1 {
+		t.Fatalf("unexpected buckets: %v", limiter.buckets)
+	}
+}
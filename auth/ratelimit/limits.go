@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"github.com/universe-10th/chasqui-identity-protocols/auth/authz"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// Limits selectable by the roles of a credential or the
+// realm it landed through. The selection is:
+//   - Among the roles of an authz.Privileged credential
+//     having a limit in ByRole, the most permissive one
+//     (an unlimited one, or else the one with the highest
+//     rate).
+//   - Otherwise, the limit of the realm in ByRealm.
+//   - Otherwise, the Default limit.
+type Limits struct {
+	Default Limit
+	ByRole  map[string]Limit
+	ByRealm map[string]Limit
+}
+
+// Selects the limit for a credential, landed through the
+// realm with the given key.
+func (limits Limits) For(credential credentials.Credential, realmKey string) Limit {
+	if privileged, ok := credential.(authz.Privileged); ok && len(limits.ByRole) > 0 {
+		found := false
+		var selected Limit
+		for role, granted := range privileged.Roles() {
+			if !granted {
+				continue
+			}
+			if limit, ok := limits.ByRole[role]; ok {
+				if limit.Unlimited() {
+					return limit
+				}
+				if !found || limit.Rate > selected.Rate {
+					selected, found = limit, true
+				}
+			}
+		}
+		if found {
+			return selected
+		}
+	}
+	if limit, ok := limits.ByRealm[realmKey]; ok {
+		return limit
+	}
+	return limits.Default
+}
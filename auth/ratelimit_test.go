@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/ratelimit"
+	"github.com/universe-10th/chasqui/types"
+)
+
+func TestThrottledUsersCanStillLogOut(t *testing.T) {
+	protocol := newTestProtocol(WithRateLimits(ratelimit.Limits{Default: ratelimit.Limit{Rate: 0.001, Burst: 1}}))
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+
+	runs, throttled := 0, 0
+	handler := protocol.RequireAuthorization(nil, func(*chasqui.Server, *chasqui.Attendant, types.Message) {
+		runs++
+	}, WithThrottled(func(*chasqui.Server, *chasqui.Attendant, types.Message) {
+		throttled++
+	}))
+	handler(server, attendant, harness.NewMessage("chat.say"))
+	handler(server, attendant, harness.NewMessage("chat.say"))
+	if runs != 1 || throttled != 1 {
+		t.Fatalf("expected one run and one throttled command, got %d and %d", runs, throttled)
+	}
+
+	invoke(t, protocol, protocol.Handlers(), server, attendant, "whoami")
+	invoke(t, protocol, protocol.Handlers(), server, attendant, "logout")
+	if protocol.Current(attendant) != nil {
+		t.Fatal("a throttled user must still be able to log out")
+	}
+}
@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/samples/realms"
+	"github.com/universe-10th/chasqui/types"
+	"github.com/universe-10th/identity/credentials"
+	realms2 "github.com/universe-10th/identity/realms"
+	"github.com/universe-10th/identity/realms/login/password"
+)
+
+// A broker whose lookups can be told to fail, and which
+// counts them.
+type flakyBroker struct {
+	*realms.DummyBroker
+	failing int32
+	lookups int32
+}
+
+func (broker *flakyBroker) ByIdentifier(identifier interface{}, template credentials.Credential) (credentials.Credential, error) {
+	atomic.AddInt32(&broker.lookups, 1)
+	if atomic.LoadInt32(&broker.failing) != 0 {
+		return nil, errors.New("broker unavailable")
+	}
+	return broker.DummyBroker.ByIdentifier(identifier, template)
+}
+
+// Creates a protocol refreshing credentials after the given
+// interval, whose realm uses the given users through a flaky
+// broker.
+func newRefreshingProtocol(interval time.Duration, users map[string]*realms.DummyCredential, options ...AuthOption) (*AuthProtocol, *flakyBroker) {
+	broker := &flakyBroker{DummyBroker: realms.NewDummyBroker(users)}
+	realm := realms2.NewRealm(credentials.NewSource(broker, &realms.DummyCredential{}), password.PasswordCheckingStep(0))
+	options = append([]AuthOption{WithCredentialRefresh(interval)}, options...)
+	return NewAuthProtocol(map[string]*realms2.Realm{"main": realm}, options...), broker
+}
+
+// Wraps a handler counting its runs.
+func countingHandler(protocol *AuthProtocol, runs *int) func(*chasqui.Server, *chasqui.Attendant, types.Message) {
+	return protocol.RequireAuthorization(nil, func(*chasqui.Server, *chasqui.Attendant, types.Message) {
+		*runs++
+	})
+}
+
+func TestRefreshLogsOutDeletedCredentials(t *testing.T) {
+	users := realms.MakeSamples()
+	protocol, _ := newRefreshingProtocol(time.Nanosecond, users, WithMultipleDomain)
+	server, attendant, other := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	login(t, protocol, server, other, "alice")
+
+	runs := 0
+	handler := countingHandler(protocol, &runs)
+	delete(users, "alice")
+	handler(server, attendant, harness.NewMessage("test"))
+	if runs != 0 {
+		t.Fatal("a deleted credential must not be authorized")
+	}
+	if protocol.Current(attendant) != nil || protocol.Current(other) != nil {
+		t.Fatal("all the sessions of a deleted credential must be logged out")
+	}
+}
+
+func TestRefreshBacksOffOnTransientErrors(t *testing.T) {
+	protocol, broker := newRefreshingProtocol(50*time.Millisecond, realms.MakeSamples())
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	time.Sleep(60 * time.Millisecond)
+
+	runs := 0
+	handler := countingHandler(protocol, &runs)
+	atomic.StoreInt32(&broker.failing, 1)
+	before := atomic.LoadInt32(&broker.lookups)
+	handler(server, attendant, harness.NewMessage("test"))
+	handler(server, attendant, harness.NewMessage("test"))
+	if runs != 2 {
+		t.Fatalf("transient errors must keep the current credential, ran %d times", runs)
+	}
+	if lookups := atomic.LoadInt32(&broker.lookups) - before; lookups != 1 {
+		t.Fatalf("expected a single lookup during the back-off, got %d", lookups)
+	}
+	session := protocol.Session(attendant)
+	if !session.RefreshRetryAt().After(time.Now()) {
+		t.Fatal("a retry moment must be set after a failure")
+	}
+	if backoff := session.RefreshFailed(time.Second, 3*time.Second); backoff != 2*time.Second {
+		t.Fatalf("the back-off must double, got %s", backoff)
+	}
+	if backoff := session.RefreshFailed(time.Second, 3*time.Second); backoff != 3*time.Second {
+		t.Fatalf("the back-off must be capped, got %s", backoff)
+	}
+}
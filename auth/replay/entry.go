@@ -0,0 +1,98 @@
+package replay
+
+import (
+	"fmt"
+	"time"
+)
+
+// A recorded auth event. Passwords are never recorded.
+type Entry struct {
+	// The moment the event was recorded.
+	Timestamp time.Time `json:"timestamp"`
+	// The name of the event: "login", "logout" or
+	// "password-change".
+	Event string `json:"event"`
+	// A synthetic id of the attendant involved in the
+	// event, so events of the same connection can be
+	// correlated when replaying them.
+	Attendant string `json:"attendant"`
+	// The key of the realm (only for login events).
+	RealmKey string `json:"realm_key,omitempty"`
+	// The identifier of the involved credential.
+	Identifier interface{} `json:"identifier,omitempty"`
+	// The error message, if the event failed.
+	Error string `json:"error,omitempty"`
+	// The kind of the logout (only for logout events).
+	Kind string `json:"kind,omitempty"`
+	// The reason of the logout (only for logout events).
+	Reason string `json:"reason,omitempty"`
+	// The stage of the logout: "before" or "after" (only
+	// for logout events).
+	Stage string `json:"stage,omitempty"`
+}
+
+// Tells the outcome of the recorded event: "failure" if
+// it has an error, and "success" otherwise.
+func (entry Entry) Outcome() string {
+	if entry.Error != "" {
+		return "failure"
+	}
+	return "success"
+}
+
+// A filter to select recorded entries. Zero-valued fields
+// do not filter anything.
+type Filter struct {
+	// Keeps only the entries having this identifier. The
+	// identifiers are compared by their string form.
+	Identifier interface{}
+	// Keeps only the entries having this realm key. Since
+	// only login entries have a realm key, the rest of the
+	// entries of the same attendant are also kept.
+	RealmKey string
+	// Keeps only the entries recorded at or after this time.
+	Since time.Time
+	// Keeps only the entries recorded before this time.
+	Until time.Time
+	// Keeps only the entries having this outcome: "success"
+	// or "failure".
+	Outcome string
+}
+
+// Tells whether an entry satisfies all the criteria of the
+// filter, except the realm key (which depends on the rest
+// of the entries of the same attendant).
+func (filter Filter) matches(entry Entry) bool {
+	if filter.Identifier != nil && fmt.Sprint(filter.Identifier) != fmt.Sprint(entry.Identifier) {
+		return false
+	}
+	if !filter.Since.IsZero() && entry.Timestamp.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !entry.Timestamp.Before(filter.Until) {
+		return false
+	}
+	if filter.Outcome != "" && filter.Outcome != entry.Outcome() {
+		return false
+	}
+	return true
+}
+
+// Selects the entries satisfying the filter, keeping their
+// order.
+func (filter Filter) Apply(entries []Entry) []Entry {
+	realms := map[string]string{}
+	var selected []Entry
+	for _, entry := range entries {
+		if entry.Event == "login" {
+			realms[entry.Attendant] = entry.RealmKey
+		}
+		if filter.RealmKey != "" && realms[entry.Attendant] != filter.RealmKey {
+			continue
+		}
+		if filter.matches(entry) {
+			selected = append(selected, entry)
+		}
+	}
+	return selected
+}
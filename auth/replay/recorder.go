@@ -0,0 +1,131 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/identity/credentials"
+	"github.com/universe-10th/identity/credentials/traits/identified"
+	"github.com/universe-10th/identity/credentials/traits/indexed"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A recorder serializes the login, logout and password
+// change events of auth protocols, as JSON lines, so they
+// can be replayed later.
+type Recorder struct {
+	encoder    *json.Encoder
+	attendants map[*chasqui.Attendant]string
+	counter    uint64
+	onError    func(error)
+	mutex      sync.Mutex
+}
+
+// Tells the synthetic id of an attendant, assigning a new
+// one if the attendant has none.
+func (recorder *Recorder) attendantID(attendant *chasqui.Attendant) string {
+	if id, ok := recorder.attendants[attendant]; ok {
+		return id
+	}
+	recorder.counter++
+	id := strconv.FormatUint(recorder.counter, 10)
+	recorder.attendants[attendant] = id
+	return id
+}
+
+// Records an entry for a given attendant. When told to,
+// the attendant is forgotten afterwards, so a new id will
+// be assigned if it is involved in further events.
+func (recorder *Recorder) record(attendant *chasqui.Attendant, entry Entry, forget bool) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	entry.Timestamp = time.Now().UTC()
+	entry.Attendant = recorder.attendantID(attendant)
+	if forget {
+		delete(recorder.attendants, attendant)
+	}
+	if err := recorder.encoder.Encode(entry); err != nil && recorder.onError != nil {
+		recorder.onError(err)
+	}
+}
+
+// Tells the identification of a credential, if any.
+func identifierOf(credential credentials.Credential) interface{} {
+	if identifiedCredential, ok := credential.(identified.Identified); ok {
+		return identifiedCredential.Identification()
+	} else if indexedCredential, ok := credential.(indexed.Indexed); ok {
+		return indexedCredential.Index()
+	}
+	return nil
+}
+
+// Tells the message of an error, or "" if nil.
+func errorMessage(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// Subscribes the recorder to the login, logout and password
+// change events of an auth protocol, with the given options.
+// Returns a function that cancels the subscriptions.
+func (recorder *Recorder) Attach(protocol *auth.AuthProtocol, options ...events.SubscriptionOption) func() {
+	subscriptions := []*events.Subscription{
+		protocol.OnLogin().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, identifier interface{}, password, realm string, credential credentials.Credential, err error) {
+			recorder.record(attendant, Entry{Event: "login", RealmKey: realm, Identifier: identifier, Error: errorMessage(err)}, err != nil)
+		}, options...),
+		protocol.OnLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kind events.LogoutKind, reason string, stage events.LogoutStage) {
+			stageName := "before"
+			if stage == events.After {
+				stageName = "after"
+			}
+			recorder.record(attendant, Entry{
+				Event: "logout", Identifier: identifierOf(credential), Kind: kind.String(), Reason: reason, Stage: stageName,
+			}, stage == events.After)
+		}, options...),
+		protocol.OnPasswordChange().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, err error) {
+			recorder.record(attendant, Entry{Event: "password-change", Identifier: identifierOf(credential), Error: errorMessage(err)}, false)
+		}, options...),
+	}
+	return func() {
+		for _, subscription := range subscriptions {
+			subscription.Cancel()
+		}
+	}
+}
+
+// Creates a new recorder writing to the given writer. An
+// optional handler for the errors occurring while writing
+// may be given.
+func NewRecorder(writer io.Writer, onError func(error)) *Recorder {
+	return &Recorder{
+		encoder:    json.NewEncoder(writer),
+		attendants: map[*chasqui.Attendant]string{},
+		onError:    onError,
+	}
+}
+
+// Loads all the entries recorded in a reader.
+func Load(reader io.Reader) ([]Entry, error) {
+	var entries []Entry
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
@@ -0,0 +1,117 @@
+package replay
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/identity/credentials"
+	realms2 "github.com/universe-10th/identity/realms"
+)
+
+// Tells the events and attendants of the given entries, as
+// "event@attendant" strings.
+func summary(entries []Entry) []string {
+	var result []string
+	for _, entry := range entries {
+		result = append(result, entry.Event+"@"+entry.Attendant)
+	}
+	return result
+}
+
+func TestFilterCarriesTheRealmAcrossTheEntriesOfAnAttendant(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time {
+		return start.Add(time.Duration(minutes) * time.Minute)
+	}
+	entries := []Entry{
+		{Timestamp: at(0), Event: "login", Attendant: "1", RealmKey: "main", Identifier: "alice"},
+		{Timestamp: at(1), Event: "login", Attendant: "2", RealmKey: "other", Identifier: "alice"},
+		{Timestamp: at(2), Event: "password-change", Attendant: "1", Identifier: "alice", Error: "failed"},
+		{Timestamp: at(3), Event: "logout", Attendant: "2", Identifier: "alice", Stage: "after"},
+		{Timestamp: at(4), Event: "logout", Attendant: "1", Identifier: "alice", Stage: "after"},
+		// After a failed login, or a logout, the recorder gives
+		// the attendant a new id.
+		{Timestamp: at(5), Event: "login", Attendant: "3", RealmKey: "main", Identifier: "bob", Error: "login failed"},
+		{Timestamp: at(6), Event: "login", Attendant: "4", RealmKey: "other", Identifier: "bob"},
+		{Timestamp: at(7), Event: "logout", Attendant: "4", Identifier: "bob", Stage: "after"},
+	}
+	for _, test := range []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{"empty", Filter{}, summary(entries)},
+		{"realm", Filter{RealmKey: "main"}, []string{"login@1", "password-change@1", "logout@1", "login@3"}},
+		{"other realm", Filter{RealmKey: "other"}, []string{"login@2", "logout@2", "login@4", "logout@4"}},
+		{"identifier", Filter{Identifier: "bob"}, []string{"login@3", "login@4", "logout@4"}},
+		{"realm and identifier", Filter{RealmKey: "main", Identifier: "bob"}, []string{"login@3"}},
+		{"outcome", Filter{Outcome: "failure"}, []string{"password-change@1", "login@3"}},
+		{"time range", Filter{Since: at(2), Until: at(4)}, []string{"password-change@1", "logout@2"}},
+	} {
+		if selected := summary(test.filter.Apply(entries)); !reflect.DeepEqual(selected, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, selected)
+		}
+	}
+}
+
+func TestRecordedEventsAreReplayed(t *testing.T) {
+	protocol := auth.NewAuthProtocol(map[string]*realms2.Realm{"main": harness.NewRealm()})
+	buffer := &bytes.Buffer{}
+	cancel := NewRecorder(buffer, func(err error) {
+		t.Error(err)
+	}).Attach(protocol)
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	harness.Invoke(t, protocol.Handlers(), server, attendant, "auth.login", "alice", "wrong", "main")
+	harness.Invoke(t, protocol.Handlers(), server, attendant, "auth.login", "alice", "alice1", "main")
+	harness.Invoke(t, protocol.Handlers(), server, attendant, "auth.change-password", "alice2")
+	harness.Invoke(t, protocol.Handlers(), server, attendant, "auth.logout")
+	harness.Invoke(t, protocol.Handlers(), server, attendant, "auth.login", "alice", "alice2", "main")
+	cancel()
+
+	entries, err := Load(buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"login@1", "login@2", "password-change@2", "logout@2", "logout@2", "login@3"}
+	if recorded := summary(entries); !reflect.DeepEqual(recorded, expected) {
+		t.Fatalf("expected %v, got %v", expected, recorded)
+	}
+	if entries[0].Outcome() != "failure" || entries[0].RealmKey != "main" || entries[0].Identifier != "alice" {
+		t.Fatalf("unexpected failed login entry: %+v", entries[0])
+	}
+
+	replayed := auth.NewAuthProtocol(map[string]*realms2.Realm{})
+	var replayedEvents []string
+	attendants := map[*chasqui.Attendant]bool{}
+	replayed.OnLogin().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, identifier interface{}, password, realm string, credential credentials.Credential, err error) {
+		if err == realms2.ErrLoginFailed {
+			replayedEvents = append(replayedEvents, "login-failed")
+		} else if replayedCredential, ok := credential.(*Credential); ok && replayedCredential.Identification() == "alice" {
+			replayedEvents = append(replayedEvents, "login")
+		}
+		attendants[attendant] = true
+	})
+	replayed.OnLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kind events.LogoutKind, reason string, stage events.LogoutStage) {
+		if stage == events.After && kind == events.Graceful {
+			replayedEvents = append(replayedEvents, "logout")
+		}
+	})
+	replayed.OnPasswordChange().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, err error) {
+		if err == nil {
+			replayedEvents = append(replayedEvents, "password-change")
+		}
+	})
+	NewReplayer(replayed, nil, nil).ReplayAll(entries)
+	if expected := []string{"login-failed", "login", "password-change", "logout", "login"}; !reflect.DeepEqual(replayedEvents, expected) {
+		t.Fatalf("expected %v, got %v", expected, replayedEvents)
+	}
+	if len(attendants) != 3 {
+		t.Fatalf("expected one synthetic attendant per recorded id, got %d", len(attendants))
+	}
+}
@@ -0,0 +1,145 @@
+package replay
+
+import (
+	"errors"
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/identity/credentials"
+	"github.com/universe-10th/identity/hashing"
+	"github.com/universe-10th/identity/realms"
+)
+
+// A stand-in credential for replayed events. It only knows
+// its identification.
+type Credential struct {
+	identifier interface{}
+}
+
+// Replayed credentials have no password.
+func (credential *Credential) HashedPassword() string {
+	return ""
+}
+
+// Replayed credentials have no password.
+func (credential *Credential) SetHashedPassword(string) {}
+
+// Replayed credentials have no hashing engine.
+func (credential *Credential) Hasher() hashing.HashingEngine {
+	return nil
+}
+
+// The recorded identifier.
+func (credential *Credential) Identification() interface{} {
+	return credential.identifier
+}
+
+// Errors known by their message, so replayed events carry
+// the same error values the listeners compare against.
+var knownErrors = []error{
+	realms.ErrLoginFailed,
+	auth.ErrRejectedByDomain,
+	auth.ErrMissingUnifiedKey,
+	events.ErrHookPanicked,
+}
+
+// Tells the error for a recorded message, or nil if empty.
+func errorFor(message string) error {
+	if message == "" {
+		return nil
+	}
+	for _, known := range knownErrors {
+		if known.Error() == message {
+			return known
+		}
+	}
+	return errors.New(message)
+}
+
+// Replays recorded entries into the listeners of an auth
+// protocol (typically a fresh one). All the entries are
+// triggered on the given server (which may be nil), with
+// one synthetic attendant per recorded attendant id. These
+// attendants are not connected: listeners must not send
+// messages through them (they would panic, and the panic
+// would be reported as any other listener panic).
+type Replayer struct {
+	protocol   *auth.AuthProtocol
+	server     *chasqui.Server
+	attendants map[string]*chasqui.Attendant
+	resolver   func(Entry) credentials.Credential
+}
+
+// Gets the synthetic attendant for a recorded id.
+func (replayer *Replayer) attendant(id string) *chasqui.Attendant {
+	if attendant, ok := replayer.attendants[id]; ok {
+		return attendant
+	}
+	attendant := &chasqui.Attendant{}
+	replayer.attendants[id] = attendant
+	return attendant
+}
+
+// Gets the credential for a recorded entry.
+func (replayer *Replayer) credential(entry Entry) credentials.Credential {
+	if replayer.resolver != nil {
+		if credential := replayer.resolver(entry); credential != nil {
+			return credential
+		}
+	}
+	if entry.Identifier == nil {
+		return nil
+	}
+	return &Credential{identifier: entry.Identifier}
+}
+
+// Tells the logout kind for a recorded name.
+func kindFor(name string) events.LogoutKind {
+	for kind := events.Graceful; kind <= events.Admin; kind++ {
+		if kind.String() == name {
+			return kind
+		}
+	}
+	return events.Forced
+}
+
+// Replays a single entry. Unknown events are ignored.
+func (replayer *Replayer) Replay(entry Entry) {
+	attendant := replayer.attendant(entry.Attendant)
+	switch entry.Event {
+	case "login":
+		var credential credentials.Credential
+		if entry.Error == "" {
+			credential = replayer.credential(entry)
+		}
+		replayer.protocol.OnLogin().Trigger(replayer.server, attendant, entry.Identifier, "", entry.RealmKey, credential, errorFor(entry.Error))
+	case "logout":
+		stage := events.Before
+		if entry.Stage == "after" {
+			stage = events.After
+		}
+		replayer.protocol.OnLogout().Trigger(replayer.server, attendant, replayer.credential(entry), kindFor(entry.Kind), entry.Reason, stage)
+	case "password-change":
+		replayer.protocol.OnPasswordChange().Trigger(replayer.server, attendant, replayer.credential(entry), errorFor(entry.Error))
+	}
+}
+
+// Replays all the given entries, in order.
+func (replayer *Replayer) ReplayAll(entries []Entry) {
+	for _, entry := range entries {
+		replayer.Replay(entry)
+	}
+}
+
+// Creates a replayer for the given protocol and server. An
+// optional resolver may give the credential for each entry
+// (e.g. by looking it up in a realm); if it is nil or gives
+// no credential, a stand-in Credential is used.
+func NewReplayer(protocol *auth.AuthProtocol, server *chasqui.Server, resolver func(Entry) credentials.Credential) *Replayer {
+	return &Replayer{
+		protocol:   protocol,
+		server:     server,
+		attendants: map[string]*chasqui.Attendant{},
+		resolver:   resolver,
+	}
+}
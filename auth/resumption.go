@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	types2 "github.com/universe-10th/chasqui-identity-protocols/auth/types"
+	"time"
+)
+
+var ErrInvalidResumeToken = errors.New("invalid or expired resume token")
+var ErrResumeVetoed = errors.New("resume vetoed")
+
+// A session being held after its attendant disconnected.
+// It will wait for a resume command from a new attendant
+// or otherwise expire after the grace period.
+type heldSession struct {
+	server    *chasqui.Server
+	attendant *chasqui.Attendant
+	timer     *time.Timer
+}
+
+// Gets the current resume token in a given attendant.
+// Returns "" if the attendant has no resume token.
+func (authProtocol *AuthProtocol) getResumeToken(attendant *chasqui.Attendant) string {
+	if value, ok := authProtocol.contextValue(attendant, authProtocol.currentResumeTokenContextKey); !ok {
+		return ""
+	} else if token, ok := value.(string); !ok {
+		return ""
+	} else {
+		return token
+	}
+}
+
+// Sets the current resume token in a given attendant.
+func (authProtocol *AuthProtocol) setResumeToken(attendant *chasqui.Attendant, token string) {
+	authProtocol.setContextValue(attendant, authProtocol.currentResumeTokenContextKey, token)
+}
+
+// Removes the current resume token from a given attendant.
+func (authProtocol *AuthProtocol) removeResumeToken(attendant *chasqui.Attendant) {
+	authProtocol.removeContextValue(attendant, authProtocol.currentResumeTokenContextKey)
+}
+
+// Holds the session of a just-disconnected attendant under
+// the given resume token. The session will expire (i.e. be
+// logged out) when the grace period elapses.
+func (authProtocol *AuthProtocol) holdSession(server *chasqui.Server, attendant *chasqui.Attendant, token string) {
+	authProtocol.heldMutex.Lock()
+	defer authProtocol.heldMutex.Unlock()
+	authProtocol.heldSessions[token] = &heldSession{
+		server:    server,
+		attendant: attendant,
+		timer: time.AfterFunc(authProtocol.resumptionGrace, func() {
+			authProtocol.expireSession(token)
+		}),
+	}
+}
+
+// Gets (without removing) a held session by its resume
+// token, given it belongs to the given server. Returns nil
+// if no such session is being held.
+func (authProtocol *AuthProtocol) peekHeldSession(server *chasqui.Server, token string) *heldSession {
+	authProtocol.heldMutex.Lock()
+	defer authProtocol.heldMutex.Unlock()
+	if held, ok := authProtocol.heldSessions[token]; ok && held.server == server {
+		return held
+	}
+	return nil
+}
+
+// Takes (removes and returns) a held session by its resume
+// token, given it belongs to the given server. Returns nil
+// if no such session is being held.
+func (authProtocol *AuthProtocol) takeHeldSession(server *chasqui.Server, token string) *heldSession {
+	authProtocol.heldMutex.Lock()
+	defer authProtocol.heldMutex.Unlock()
+	if held, ok := authProtocol.heldSessions[token]; ok && held.server == server {
+		held.timer.Stop()
+		delete(authProtocol.heldSessions, token)
+		return held
+	}
+	return nil
+}
+
+// Drops the held session of a given attendant, if any.
+// This happens when a held session is logged out before
+// it expires (e.g. it was revoked).
+func (authProtocol *AuthProtocol) dropHeldSession(attendant *chasqui.Attendant) {
+	if token := authProtocol.getResumeToken(attendant); token != "" {
+		authProtocol.heldMutex.Lock()
+		defer authProtocol.heldMutex.Unlock()
+		if held, ok := authProtocol.heldSessions[token]; ok && held.attendant == attendant {
+			held.timer.Stop()
+			delete(authProtocol.heldSessions, token)
+		}
+	}
+}
+
+// Expires a held session by its resume token. The session
+// is logged out, if it was not resumed in the meantime.
+func (authProtocol *AuthProtocol) expireSession(token string) {
+	authProtocol.heldMutex.Lock()
+	held, ok := authProtocol.heldSessions[token]
+	if ok {
+		held.timer.Stop()
+		delete(authProtocol.heldSessions, token)
+	}
+	authProtocol.heldMutex.Unlock()
+	if ok {
+		if session := authProtocol.getSession(held.attendant); session != nil {
+			authProtocol.OnSessionExpired().Trigger(held.server, held.attendant, session)
+		}
+		authProtocol.Logout(held.server, held.attendant, events.Expired, "")
+	}
+}
+
+// Expires, right now, all the sessions held for a server.
+func (authProtocol *AuthProtocol) expireHeldSessions(server *chasqui.Server) {
+	var tokens []string
+	authProtocol.heldMutex.Lock()
+	for token, held := range authProtocol.heldSessions {
+		if held.server == server {
+			tokens = append(tokens, token)
+		}
+	}
+	authProtocol.heldMutex.Unlock()
+	for _, token := range tokens {
+		authProtocol.expireSession(token)
+	}
+}
+
+// Resumes a held session by its resume token, binding it to
+// the given attendant. The credential, qualified key and the
+// session itself are moved to the new attendant, which will
+// also have a new resume token (returned, with the session).
+// The before-landing hooks run first, with the credential and
+// key of the held session and the new attendant: if any of
+// them vetoes the resume, an error wrapping ErrResumeVetoed is
+// returned and the session keeps being held.
+func (authProtocol *AuthProtocol) resumeSession(server *chasqui.Server, attendant *chasqui.Attendant, token string) (string, *types2.Session, error) {
+	newToken, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	if held := authProtocol.peekHeldSession(server, token); held == nil {
+		return "", nil, ErrInvalidResumeToken
+	} else if credential, key := authProtocol.getCredential(held.attendant), authProtocol.getQualifiedKey(held.attendant, false); credential != nil && key != nil {
+		if err := authProtocol.OnBeforeLanding().Run(credential, *key, attendant); err != nil {
+			return "", nil, fmt.Errorf("%w: %s", ErrResumeVetoed, err.Error())
+		}
+	}
+	held := authProtocol.takeHeldSession(server, token)
+	if held == nil {
+		return "", nil, ErrInvalidResumeToken
+	}
+
+	// Everything is read and validated before tearing down
+	// the previous attendant. An invalid held session is
+	// logged out as a whole, instead of half-removed.
+	previous := held.attendant
+	credential := authProtocol.getCredential(previous)
+	session := authProtocol.getSession(previous)
+	qualifiedKey := authProtocol.getQualifiedKey(previous, false)
+	if credential == nil || session == nil || qualifiedKey == nil {
+		authProtocol.Logout(held.server, previous, events.Expired, "")
+		return "", nil, ErrInvalidResumeToken
+	}
+
+	// The new session is added before removing the previous
+	// one, so the unified key is kept in the domain.
+	unifiedKey := authProtocol.domain.AddSession(*qualifiedKey, server, attendant)
+	authProtocol.domain.RemoveSession(*qualifiedKey, server, previous)
+	authProtocol.getQualifiedKey(previous, true)
+	authProtocol.removeCredential(previous)
+	authProtocol.removeSession(previous)
+	authProtocol.removeResumeToken(previous)
+
+	authProtocol.setCredential(attendant, credential)
+	authProtocol.setQualifiedKey(attendant, unifiedKey)
+	session.Rebind(attendant, authProtocol.remoteAddress(attendant))
+	authProtocol.setSession(attendant, session)
+	authProtocol.setResumeToken(attendant, newToken)
+	return newToken, session, nil
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	types2 "github.com/universe-10th/chasqui-identity-protocols/auth/types"
+	"github.com/universe-10th/identity/credentials"
+)
+
+// Waits until the condition holds, or fails the test.
+func eventually(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(2 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestHeldSessionExpiresAfterGrace(t *testing.T) {
+	protocol := newTestProtocol(WithResumption(30 * time.Millisecond))
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	key := *protocol.getQualifiedKey(attendant, false)
+
+	var expired, loggedOut int32
+	var kind events.LogoutKind
+	protocol.OnSessionExpired().Register(func(*chasqui.Server, *chasqui.Attendant, *types2.Session) {
+		atomic.AddInt32(&expired, 1)
+	})
+	protocol.OnLogout().Register(func(_ *chasqui.Server, _ *chasqui.Attendant, _ credentials.Credential, logoutKind events.LogoutKind, _ string, stage events.LogoutStage) {
+		if stage == events.After {
+			kind = logoutKind
+			atomic.AddInt32(&loggedOut, 1)
+		}
+	})
+
+	protocol.AttendantStopped(server, attendant, chasqui.AttendantRemoteStop, nil)
+	if protocol.Current(attendant) == nil {
+		t.Fatal("the session must be held during the grace period")
+	}
+	eventually(t, func() bool { return atomic.LoadInt32(&loggedOut) == 1 })
+	if atomic.LoadInt32(&expired) != 1 || kind != events.Expired {
+		t.Fatalf("expected one expiry with the Expired kind, got %d and %s", expired, kind)
+	}
+	if protocol.Current(attendant) != nil || len(protocol.domain.Attendants(server, key)) != 0 {
+		t.Fatal("the expired session must be fully logged out")
+	}
+}
+
+func TestHeldSessionResumes(t *testing.T) {
+	server, previous, next := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	addresses := map[*chasqui.Attendant]string{previous: "10.0.0.1", next: "10.0.0.2"}
+	protocol := newTestProtocol(WithResumption(30*time.Millisecond), WithRemoteAddressResolver(func(attendant *chasqui.Attendant) string {
+		return addresses[attendant]
+	}))
+	login(t, protocol, server, previous, "alice")
+	session := protocol.Session(previous)
+	token := protocol.getResumeToken(previous)
+
+	protocol.AttendantStopped(server, previous, chasqui.AttendantRemoteStop, nil)
+	invoke(t, protocol, protocol.Handlers(), server, next, "resume", token)
+
+	if protocol.Current(next) == nil || protocol.Current(previous) != nil {
+		t.Fatal("the session must move to the new attendant")
+	}
+	if protocol.Session(next) != session || session.Attendant() != next {
+		t.Fatal("the same session must be rebound to the new attendant")
+	}
+	if session.RemoteAddress() != "10.0.0.2" {
+		t.Fatalf("the session must have the new remote address, got %q", session.RemoteAddress())
+	}
+	// The grace timer must not log the resumed session out.
+	time.Sleep(60 * time.Millisecond)
+	if protocol.Current(next) == nil {
+		t.Fatal("the resumed session must survive the grace period")
+	}
+	// The old token cannot be used again.
+	if _, _, err := protocol.resumeSession(server, harness.NewAttendant(t), token); err != ErrInvalidResumeToken {
+		t.Fatalf("expected ErrInvalidResumeToken, got %v", err)
+	}
+}
+
+func TestInvalidHeldSessionIsLoggedOutAsAWhole(t *testing.T) {
+	protocol := newTestProtocol(WithResumption(time.Minute))
+	server, previous, next := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, previous, "alice")
+	key := *protocol.getQualifiedKey(previous, false)
+	token := protocol.getResumeToken(previous)
+	protocol.AttendantStopped(server, previous, chasqui.AttendantRemoteStop, nil)
+	protocol.removeSession(previous)
+
+	if _, _, err := protocol.resumeSession(server, next, token); err != ErrInvalidResumeToken {
+		t.Fatalf("expected ErrInvalidResumeToken, got %v", err)
+	}
+	if protocol.Current(previous) != nil || protocol.getQualifiedKey(previous, false) != nil {
+		t.Fatal("the previous attendant must not be left half torn down")
+	}
+	if len(protocol.domain.Attendants(server, key)) != 0 {
+		t.Fatal("the previous attendant must leave the domain")
+	}
+}
+
+func TestExpiryRacingAnotherLogoutLogsOutOnce(t *testing.T) {
+	for round := 0; round < 20; round++ {
+		protocol := newTestProtocol(WithResumption(time.Millisecond))
+		server, attendant := harness.NewServer(), harness.NewAttendant(t)
+		login(t, protocol, server, attendant, "alice")
+		key := *protocol.getQualifiedKey(attendant, false)
+
+		var logouts int32
+		protocol.OnLogout().Register(func(_ *chasqui.Server, _ *chasqui.Attendant, _ credentials.Credential, _ events.LogoutKind, _ string, stage events.LogoutStage) {
+			if stage == events.Before {
+				atomic.AddInt32(&logouts, 1)
+			}
+		})
+
+		protocol.AttendantStopped(server, attendant, chasqui.AttendantRemoteStop, nil)
+		var group sync.WaitGroup
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			protocol.LogoutAll(server, key, "logout-all")
+		}()
+		group.Wait()
+		eventually(t, func() bool {
+			protocol.heldMutex.Lock()
+			defer protocol.heldMutex.Unlock()
+			return len(protocol.heldSessions) == 0
+		})
+		time.Sleep(5 * time.Millisecond)
+		if count := atomic.LoadInt32(&logouts); count != 1 {
+			t.Fatalf("expected exactly one logout, got %d", count)
+		}
+	}
+}
+
+func TestResumeRunsTheBeforeLandingHooks(t *testing.T) {
+	protocol := newTestProtocol(WithResumption(time.Minute))
+	server, previous, next := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, previous, "alice")
+	token := protocol.getResumeToken(previous)
+	protocol.AttendantStopped(server, previous, chasqui.AttendantRemoteStop, nil)
+
+	var landedWith interface{}
+	maintenance := true
+	protocol.OnBeforeLanding().Register(func(_ credentials.Credential, key types2.QualifiedKey, attendant *chasqui.Attendant) error {
+		if attendant != next {
+			t.Errorf("the hook must receive the new attendant")
+		}
+		landedWith = key.Key()
+		if maintenance {
+			return errors.New("maintenance")
+		}
+		return nil
+	})
+
+	if _, _, err := protocol.resumeSession(server, next, token); !errors.Is(err, ErrResumeVetoed) {
+		t.Fatalf("expected ErrResumeVetoed, got %v", err)
+	}
+	if protocol.Current(next) != nil || protocol.Current(previous) == nil || landedWith != "alice" {
+		t.Fatal("a vetoed resume must keep the session held")
+	}
+	maintenance = false
+	invoke(t, protocol, protocol.Handlers(), server, next, "resume", token)
+	if protocol.Current(next) == nil {
+		t.Fatal("the session must be resumed once allowed")
+	}
+}
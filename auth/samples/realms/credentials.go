@@ -3,8 +3,10 @@ package realms
 import "github.com/universe-10th/identity/hashing"
 
 type DummyCredential struct {
-	username interface{}
-	password string
+	username    interface{}
+	password    string
+	roles       map[string]bool
+	permissions map[string]bool
 }
 
 func (credential *DummyCredential) HashedPassword() string {
@@ -22,3 +24,11 @@ func (credential *DummyCredential) Hasher() hashing.HashingEngine {
 func (credential *DummyCredential) Identification() interface{} {
 	return credential.username
 }
+
+func (credential *DummyCredential) Roles() map[string]bool {
+	return credential.roles
+}
+
+func (credential *DummyCredential) Permissions() map[string]bool {
+	return credential.permissions
+}
@@ -9,16 +9,24 @@ import (
 	"time"
 )
 
+func set(values ...string) map[string]bool {
+	result := make(map[string]bool, len(values))
+	for _, value := range values {
+		result[value] = true
+	}
+	return result
+}
+
 func MakeSamples() map[string]*DummyCredential {
 	alicepw, _ := DummyHasher(0).Hash("alice1")
 	bobpw, _ := DummyHasher(0).Hash("bob1")
 	carlpw, _ := DummyHasher(0).Hash("carl1")
 	dannypw, _ := DummyHasher(0).Hash("danny1")
 	return map[string]*DummyCredential{
-		"alice": &DummyCredential{"alice", alicepw},
-		"bob":   &DummyCredential{"bob", bobpw},
-		"carl":  &DummyCredential{"carl", carlpw},
-		"danny": &DummyCredential{"danny", dannypw},
+		"alice": &DummyCredential{"alice", alicepw, set("admin"), set("chat.shout", "chat.whisper")},
+		"bob":   &DummyCredential{"bob", bobpw, set("member"), set("chat.shout", "chat.whisper")},
+		"carl":  &DummyCredential{"carl", carlpw, set("member"), set("chat.whisper")},
+		"danny": &DummyCredential{"danny", dannypw, set("guest"), set()},
 	}
 }
 
@@ -120,7 +120,7 @@ func NewChatProtocol(authProtocol *auth2.AuthProtocol) *ChatProtocol {
 
 		sessions[credential.(identified.Identified).Identification().(string)] = attendant
 	})
-	authProtocol.OnLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, stage events.LogoutStage) {
+	authProtocol.OnLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kind events.LogoutKind, reason string, stage events.LogoutStage) {
 		if stage == events.Before {
 			if sessions, ok := chatProtocol.sessions[server]; ok {
 				delete(sessions, credential.(identified.Identified).Identification().(string))
@@ -128,7 +128,7 @@ func NewChatProtocol(authProtocol *auth2.AuthProtocol) *ChatProtocol {
 		} else if stage == events.After {
 			for _, attendant2 := range chatProtocol.sessions[server] {
 				// noinspection GoUnhandledErrorResult
-				attendant2.Send("chat.PART", types.Args{credential.(identified.Identified).Identification().(string)}, nil)
+				attendant2.Send("chat.PART", types.Args{credential.(identified.Identified).Identification().(string), kind.String()}, nil)
 			}
 		}
 	})
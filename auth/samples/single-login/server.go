@@ -3,6 +3,7 @@ package main
 import (
 	"github.com/universe-10th/chasqui"
 	"github.com/universe-10th/chasqui-identity-protocols/auth"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/logging"
 	realms2 "github.com/universe-10th/chasqui-identity-protocols/auth/samples/realms"
 	protocols "github.com/universe-10th/chasqui-protocols"
 	"github.com/universe-10th/chasqui/marshalers/json"
@@ -13,6 +14,7 @@ var funnel, _ = protocols.NewProtocolsFunnel([]protocols.Protocol{NewChatProtoco
 	map[string]*realms.Realm{
 		"main": realms2.DummyRealm,
 	}, auth.WithPrefix("my-auth"),
+	auth.WithLogger(logging.NewStdLogger(nil, logging.Info)),
 ))})
 
 func makeServer() *chasqui.Server {
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/universe-10th/chasqui-identity-protocols/auth/internal/harness"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/samples/realms"
+	"github.com/universe-10th/identity/credentials"
+	realms2 "github.com/universe-10th/identity/realms"
+	"github.com/universe-10th/identity/realms/login/password"
+)
+
+func TestLoginRequiresNotBeingLoggedIn(t *testing.T) {
+	protocol := newTestProtocol()
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	login(t, protocol, server, attendant, "alice")
+	invoke(t, protocol, protocol.Handlers(), server, attendant, "login", "bob", "bob1", "main")
+	if session := protocol.Session(attendant); session == nil || session.Key().Key() != "alice" {
+		t.Fatal("a second login in the same attendant must be rejected")
+	}
+}
+
+func TestSessionsByKeySkipsOtherCredentials(t *testing.T) {
+	protocol := newTestProtocol(WithMultipleDomain)
+	server, alice, bob := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, alice, "alice")
+	login(t, protocol, server, bob, "bob")
+	key := *protocol.getQualifiedKey(alice, false)
+
+	// A stale domain entry: alice's attendant now holds the
+	// session of bob.
+	protocol.setSession(alice, protocol.Session(bob))
+	if sessions := protocol.sessionsByKey(server, key); len(sessions) != 0 {
+		t.Fatalf("sessions of other credentials must not be listed: %v", sessions)
+	}
+	if err := protocol.revokeSession(server, alice, protocol.Session(bob).ID()); err != ErrUnknownSession {
+		t.Fatalf("sessions of other credentials must not be revoked, got %v", err)
+	}
+	if protocol.Current(bob) == nil {
+		t.Fatal("bob must stay logged in")
+	}
+}
+
+func TestSessionsOfMatchesTheRealm(t *testing.T) {
+	protocol := NewAuthProtocol(map[string]*realms2.Realm{"main": harness.NewRealm(), "other": harness.NewRealm()})
+	server, main, other := harness.NewServer(), harness.NewAttendant(t), harness.NewAttendant(t)
+	login(t, protocol, server, main, "alice")
+	invoke(t, protocol, protocol.Handlers(), server, other, "login", "alice", "alice1", "other")
+	if protocol.Current(other) == nil {
+		t.Fatal("alice could not log in the other realm")
+	}
+
+	alice := realms.MakeSamples()["alice"]
+	for realmKey, attendant := range map[string]interface{}{"main": main, "other": other} {
+		sessions := protocol.SessionsOf(alice, realmKey)
+		if len(sessions) != 1 || sessions[0].Attendant() != attendant {
+			t.Fatalf("%s: expected only the session in that realm, got %v", realmKey, sessions)
+		}
+	}
+	if sessions := protocol.SessionsOf(alice, "missing"); sessions != nil {
+		t.Fatalf("no session must be found in a missing realm: %v", sessions)
+	}
+}
+
+// A broker finding the sample users case-insensitively.
+type caseInsensitiveBroker struct {
+	*realms.DummyBroker
+}
+
+func (broker caseInsensitiveBroker) ByIdentifier(identifier interface{}, template credentials.Credential) (credentials.Credential, error) {
+	if name, ok := identifier.(string); ok {
+		identifier = strings.ToLower(name)
+	}
+	return broker.DummyBroker.ByIdentifier(identifier, template)
+}
+
+func TestSessionKeepsTheLoginIdentifier(t *testing.T) {
+	realm := realms2.NewRealm(
+		credentials.NewSource(caseInsensitiveBroker{realms.NewDummyBroker(realms.MakeSamples())}, &realms.DummyCredential{}),
+		password.PasswordCheckingStep(0),
+	)
+	protocol := NewAuthProtocol(map[string]*realms2.Realm{"main": realm})
+	server, attendant := harness.NewServer(), harness.NewAttendant(t)
+	invoke(t, protocol, protocol.Handlers(), server, attendant, "login", "Alice", "alice1", "main")
+	session := protocol.Session(attendant)
+	if session == nil {
+		t.Fatal("Alice could not log in")
+	}
+	if session.Identifier() != "Alice" || session.Key().Key() != "alice" {
+		t.Fatalf("expected the Alice identifier and the alice key, got %v and %v", session.Identifier(), session.Key().Key())
+	}
+}
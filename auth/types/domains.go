@@ -3,6 +3,7 @@ package types
 import (
 	"github.com/universe-10th/chasqui"
 	"github.com/universe-10th/identity/credentials"
+	"sync"
 )
 
 // Domain rules tell how a domain must handle users being
@@ -64,6 +65,22 @@ const (
 	Custom
 )
 
+// The name of the domain rule.
+func (rule DomainRule) String() string {
+	switch rule {
+	case Multiple:
+		return "multiple"
+	case SingleLocking:
+		return "single-locking"
+	case SingleGhosting:
+		return "single-ghosting"
+	case Custom:
+		return "custom"
+	default:
+		return "unknown"
+	}
+}
+
 // A domain keeps tracks of the currently logged in users.
 // It also handles how the current and incoming sessions
 // for a given credential will coexist. Domains are used
@@ -82,6 +99,17 @@ type Domain struct {
 	// Given a well known pointer, gets a map of
 	// attendants using the matching credential.
 	sessions map[*chasqui.Server]map[*QualifiedKey]map[*chasqui.Attendant]bool
+	// Guards the maps, since sessions may be removed from
+	// goroutines other than the server's (e.g. timers).
+	mutex sync.Mutex
+}
+
+// A (server, key, attendant) entry, used to iterate over
+// a snapshot of the sessions without holding the lock.
+type domainEntry struct {
+	server    *chasqui.Server
+	key       *QualifiedKey
+	attendant *chasqui.Attendant
 }
 
 // For a given server this domain is used on, and a
@@ -120,6 +148,8 @@ func (domain *Domain) clearKey(server *chasqui.Server, key *QualifiedKey) {
 // status of the domain.
 func (domain *Domain) CheckLanding(credential credentials.Credential, key QualifiedKey,
 	server *chasqui.Server, attendant *chasqui.Attendant) (bool, map[*chasqui.Attendant]bool) {
+	domain.mutex.Lock()
+	defer domain.mutex.Unlock()
 	switch domain.rule {
 	case Multiple:
 		// Since multiple logins are allowed, then there
@@ -144,7 +174,11 @@ func (domain *Domain) CheckLanding(credential credentials.Credential, key Qualif
 		if keys, ok := domain.unifiedKeys[server]; ok {
 			if unified, ok := keys[key]; ok {
 				if currentSessions, ok := domain.sessions[server][unified]; ok {
-					return false, currentSessions
+					ghost := make(map[*chasqui.Attendant]bool, len(currentSessions))
+					for current := range currentSessions {
+						ghost[current] = true
+					}
+					return false, ghost
 				}
 			}
 		}
@@ -158,6 +192,8 @@ func (domain *Domain) CheckLanding(credential credentials.Credential, key Qualif
 // adds the current attendant to the domain under the server
 // and the unified key related to the given key.
 func (domain *Domain) AddSession(key QualifiedKey, server *chasqui.Server, attendant *chasqui.Attendant) *QualifiedKey {
+	domain.mutex.Lock()
+	defer domain.mutex.Unlock()
 	qualifiedKey := domain.unifyKey(server, key)
 	if _, ok := domain.sessions[server]; !ok {
 		domain.sessions[server] = map[*QualifiedKey]map[*chasqui.Attendant]bool{}
@@ -176,24 +212,72 @@ func (domain *Domain) AddSession(key QualifiedKey, server *chasqui.Server, atten
 // server, and checks whether the corresponding unified key
 // should also be cleared.
 func (domain *Domain) RemoveSession(key QualifiedKey, server *chasqui.Server, attendant *chasqui.Attendant) {
+	domain.mutex.Lock()
+	defer domain.mutex.Unlock()
 	qualifiedKey := domain.unifyKey(server, key)
 	delete(domain.sessions[server][qualifiedKey], attendant)
 	domain.clearKey(server, qualifiedKey)
 }
 
+// Takes a snapshot of the current sessions, optionally
+// restricted to a given server (if not nil).
+func (domain *Domain) snapshot(server *chasqui.Server) []domainEntry {
+	domain.mutex.Lock()
+	defer domain.mutex.Unlock()
+	var entries []domainEntry
+	for currentServer, serverSessions := range domain.sessions {
+		if server != nil && server != currentServer {
+			continue
+		}
+		for qualifiedKey, attendantsMap := range serverSessions {
+			for attendant := range attendantsMap {
+				entries = append(entries, domainEntry{currentServer, qualifiedKey, attendant})
+			}
+		}
+	}
+	return entries
+}
+
 // Given a server, enumerates all the current sessions
 // telling their qualified key and their underlying socket.
 // If the callback returns true, the iteration will stop.
+// Sessions may be safely removed from inside the callback.
 func (domain *Domain) Enumerate(server *chasqui.Server, callback func(*QualifiedKey, *chasqui.Attendant) bool) {
-	if serverSessions, ok := domain.sessions[server]; ok {
-		for qualifiedKey, attendantsMap := range serverSessions {
-			for attendant, _ := range attendantsMap {
-				if callback(qualifiedKey, attendant) {
-					return
-				}
-			}
+	if server == nil {
+		return
+	}
+	for _, entry := range domain.snapshot(server) {
+		if callback(entry.key, entry.attendant) {
+			return
+		}
+	}
+}
+
+// Enumerates all the current sessions in all the servers,
+// telling their server, qualified key and underlying socket.
+// If the callback returns true, the iteration will stop.
+// Sessions may be safely removed from inside the callback.
+func (domain *Domain) EnumerateAll(callback func(*chasqui.Server, *QualifiedKey, *chasqui.Attendant) bool) {
+	for _, entry := range domain.snapshot(nil) {
+		if callback(entry.server, entry.key, entry.attendant) {
+			return
+		}
+	}
+}
+
+// Given a server and a qualified key, returns all the attendants
+// having a session with the corresponding unified key. This list
+// is a copy, so sessions can be safely removed while iterating it.
+func (domain *Domain) Attendants(server *chasqui.Server, key QualifiedKey) []*chasqui.Attendant {
+	domain.mutex.Lock()
+	defer domain.mutex.Unlock()
+	var attendants []*chasqui.Attendant
+	if unified, ok := domain.unifiedKeys[server][key]; ok {
+		for attendant := range domain.sessions[server][unified] {
+			attendants = append(attendants, attendant)
 		}
 	}
+	return attendants
 }
 
 // Gets the rule the domain was created with.
@@ -5,21 +5,29 @@ import (
 	"github.com/universe-10th/identity/credentials/traits/identified"
 	"github.com/universe-10th/identity/credentials/traits/indexed"
 	"github.com/universe-10th/identity/realms"
+	"reflect"
 )
 
 // A tracking session key, to consider many different
 // credentials, which are actually the same, effectively
 // the same at effects of logged-in users.
 type QualifiedKey struct {
-	key   interface{}
-	realm *realms.Realm
+	key      interface{}
+	realmKey string
+	realm    *realms.Realm
 }
 
 // The key part of this qualified key. This key may be
 // the credential's identifier, the credential's lookup
 // index, or the identifier used on login.
 func (qualifiedKey QualifiedKey) Key() interface{} {
-	return qualifiedKey.Key
+	return qualifiedKey.key
+}
+
+// The key of the realm, as registered in the protocol
+// the credential landed through.
+func (qualifiedKey QualifiedKey) RealmKey() string {
+	return qualifiedKey.realmKey
 }
 
 // The realm that serves as a namespace that qualifies
@@ -28,31 +36,50 @@ func (qualifiedKey QualifiedKey) Realm() *realms.Realm {
 	return qualifiedKey.realm
 }
 
+// Tells whether two qualified keys are the same. Unlike
+// the == operator, this does not panic when the keys are
+// not comparable: such keys are deeply compared instead.
+func (qualifiedKey QualifiedKey) Equals(other QualifiedKey) bool {
+	if qualifiedKey.realm != other.realm || qualifiedKey.realmKey != other.realmKey {
+		return false
+	}
+	if qualifiedKey.key == nil || other.key == nil {
+		return qualifiedKey.key == other.key
+	}
+	if reflect.TypeOf(qualifiedKey.key).Comparable() && reflect.TypeOf(other.key).Comparable() {
+		return qualifiedKey.key == other.key
+	}
+	return reflect.DeepEqual(qualifiedKey.key, other.key)
+}
+
 // Creates a session key to track, for different credential
 // instances, how many of them are the same (to tell when
 // the logged credentials are the same). Given the login
 // credential, it attempts to retrieve its identification,
 // its index, or use the identification that was used on
 // login (usually a bad idea, since it has a chance of being
-// non-unique).
-func NewQualifiedKey(credential credentials.Credential, identifier interface{}, realm *realms.Realm) QualifiedKey {
+// non-unique). The realm is also given by its key.
+func NewQualifiedKey(credential credentials.Credential, identifier interface{}, realmKey string, realm *realms.Realm) QualifiedKey {
 	if identifiedCredential, ok := credential.(identified.Identified); ok {
 		return QualifiedKey{
-			key:   identifiedCredential.Identification(),
-			realm: realm,
+			key:      identifiedCredential.Identification(),
+			realmKey: realmKey,
+			realm:    realm,
 		}
 	} else if indexedCredential, ok := credential.(indexed.Indexed); ok {
 		return QualifiedKey{
-			key:   indexedCredential.Index(),
-			realm: realm,
+			key:      indexedCredential.Index(),
+			realmKey: realmKey,
+			realm:    realm,
 		}
 	} else {
 		// This scenario is not recommended when the identifier is case-insensitive,
 		// for duplicate entries may exist when different users log in with the
 		// same account but using different casing.
 		return QualifiedKey{
-			key:   identifier,
-			realm: realm,
+			key:      identifier,
+			realmKey: realmKey,
+			realm:    realm,
 		}
 	}
 }
@@ -0,0 +1,18 @@
+package types
+
+import "testing"
+
+func TestQualifiedKeyEqualsNonComparable(t *testing.T) {
+	first := QualifiedKey{key: []string{"alice"}, realmKey: "main"}
+	second := QualifiedKey{key: []string{"alice"}, realmKey: "main"}
+	third := QualifiedKey{key: []string{"bob"}, realmKey: "main"}
+	if !first.Equals(second) {
+		t.Error("equal non-comparable keys must be equal")
+	}
+	if first.Equals(third) {
+		t.Error("different non-comparable keys must not be equal")
+	}
+	if (QualifiedKey{key: "alice", realmKey: "main"}).Equals(QualifiedKey{key: "alice", realmKey: "other"}) {
+		t.Error("keys in different realms must not be equal")
+	}
+}
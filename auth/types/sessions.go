@@ -0,0 +1,245 @@
+package types
+
+import (
+	"github.com/universe-10th/chasqui"
+	"sync"
+	"time"
+)
+
+// A session record is created each time a credential
+// successfully lands in a domain for a given attendant.
+// It identifies that particular session among all the
+// sessions the same credential may have, and is used
+// to list and revoke them. Applications may attach their
+// own arbitrary metadata to a session.
+type Session struct {
+	// A random identifier for this session.
+	id string
+	// The moment this session was created.
+	loginTime time.Time
+	// The moment of the last activity in this session.
+	lastActivity time.Time
+	// The moment the credential of this session was last
+	// loaded (or reloaded) from its realm.
+	credentialLoaded time.Time
+	// The consecutive failures to refresh the credential,
+	// and the moment it can be retried.
+	refreshFailures int
+	refreshRetryAt  time.Time
+	// The identifier the credential logged in with.
+	identifier interface{}
+	// The remote address of the attendant, if it could
+	// be resolved when the session was created.
+	remoteAddress string
+	// The key of the realm the session logged in through.
+	realmKey string
+	// A label for the client device, supplied by the client
+	// on login. It may be empty.
+	device string
+	// Arbitrary metadata set by the application.
+	metadata map[string]interface{}
+	// Cached authorization decisions, by wrap site. Only
+	// used when the protocol caches authorization.
+	decisions map[interface{}]bool
+	// The (unified) qualified key the session was landed
+	// with in the domain.
+	key *QualifiedKey
+	// The server the session belongs to.
+	server *chasqui.Server
+	// The attendant the session belongs to.
+	attendant *chasqui.Attendant
+	// Guards the mutable fields of this session.
+	mutex sync.RWMutex
+}
+
+// The random identifier of this session.
+func (session *Session) ID() string {
+	return session.id
+}
+
+// The moment this session was created.
+func (session *Session) LoginTime() time.Time {
+	return session.loginTime
+}
+
+// The moment of the last activity in this session.
+func (session *Session) LastActivity() time.Time {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	return session.lastActivity
+}
+
+// Marks the current moment as the last activity in
+// this session.
+func (session *Session) Touch() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.lastActivity = time.Now()
+}
+
+// The moment the credential of this session was last
+// loaded (or reloaded) from its realm.
+func (session *Session) CredentialLoaded() time.Time {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	return session.credentialLoaded
+}
+
+// Marks the current moment as the last time the
+// credential of this session was loaded.
+func (session *Session) MarkCredentialLoaded() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.credentialLoaded = time.Now()
+	session.refreshFailures = 0
+	session.refreshRetryAt = time.Time{}
+}
+
+// The moment a failed credential refresh can be retried.
+// It is the zero time if the last refresh did not fail.
+func (session *Session) RefreshRetryAt() time.Time {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	return session.refreshRetryAt
+}
+
+// Records a failed credential refresh, and returns the
+// back-off until it can be retried: it starts at the
+// given minimum, and doubles on each consecutive failure
+// up to the given maximum.
+func (session *Session) RefreshFailed(minimum, maximum time.Duration) time.Duration {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	backoff := minimum
+	for index := 0; index < session.refreshFailures && backoff < maximum; index++ {
+		backoff *= 2
+	}
+	if backoff > maximum {
+		backoff = maximum
+	}
+	session.refreshFailures++
+	session.refreshRetryAt = time.Now().Add(backoff)
+	return backoff
+}
+
+// The identifier the credential of this session logged
+// in with (which is not necessarily the key it is known
+// by in the domain: that one may be its index).
+func (session *Session) Identifier() interface{} {
+	return session.identifier
+}
+
+// The remote address of this session's attendant, or
+// an empty string if it could not be resolved.
+func (session *Session) RemoteAddress() string {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	return session.remoteAddress
+}
+
+// The key of the realm this session logged in through.
+func (session *Session) RealmKey() string {
+	return session.realmKey
+}
+
+// The client-supplied device label of this session.
+func (session *Session) Device() string {
+	return session.device
+}
+
+// Gets a metadata value by its key. It also returns
+// whether the value was found.
+func (session *Session) Metadata(key string) (interface{}, bool) {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	value, ok := session.metadata[key]
+	return value, ok
+}
+
+// Sets a metadata value by its key.
+func (session *Session) SetMetadata(key string, value interface{}) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.metadata[key] = value
+}
+
+// Removes a metadata value by its key.
+func (session *Session) RemoveMetadata(key string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	delete(session.metadata, key)
+}
+
+// Gets a cached authorization decision, by its key, and
+// whether it was cached.
+func (session *Session) Decision(key interface{}) (bool, bool) {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	decision, ok := session.decisions[key]
+	return decision, ok
+}
+
+// Caches an authorization decision, by its key.
+func (session *Session) SetDecision(key interface{}, decision bool) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.decisions[key] = decision
+}
+
+// Drops all the cached authorization decisions.
+func (session *Session) ClearDecisions() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.decisions = map[interface{}]bool{}
+}
+
+// The unified qualified key this session was landed with.
+func (session *Session) Key() *QualifiedKey {
+	return session.key
+}
+
+// The server this session belongs to.
+func (session *Session) Server() *chasqui.Server {
+	return session.server
+}
+
+// The attendant this session belongs to.
+func (session *Session) Attendant() *chasqui.Attendant {
+	session.mutex.RLock()
+	defer session.mutex.RUnlock()
+	return session.attendant
+}
+
+// Binds this session to a new attendant, having the given
+// remote address. This is meant to be used by the auth
+// protocol when a session is resumed from a new connection.
+func (session *Session) Rebind(attendant *chasqui.Attendant, remoteAddress string) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+	session.attendant = attendant
+	session.remoteAddress = remoteAddress
+	session.lastActivity = time.Now()
+}
+
+// Creates a new session record, for a given id, unified key,
+// server, attendant and login identifier. Both the login time
+// and the last activity time will be the current one.
+func NewSession(id string, key *QualifiedKey, server *chasqui.Server, attendant *chasqui.Attendant,
+	identifier interface{}, remoteAddress, realmKey, device string) *Session {
+	now := time.Now()
+	return &Session{
+		id:               id,
+		loginTime:        now,
+		lastActivity:     now,
+		credentialLoaded: now,
+		identifier:       identifier,
+		remoteAddress:    remoteAddress,
+		realmKey:         realmKey,
+		device:           device,
+		metadata:         map[string]interface{}{},
+		decisions:        map[interface{}]bool{},
+		key:              key,
+		server:           server,
+		attendant:        attendant,
+	}
+}
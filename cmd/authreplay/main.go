@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/universe-10th/chasqui"
+	"github.com/universe-10th/chasqui-identity-protocols/auth"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/events"
+	"github.com/universe-10th/chasqui-identity-protocols/auth/replay"
+	"github.com/universe-10th/identity/credentials"
+	"github.com/universe-10th/identity/realms"
+	"io"
+	"os"
+	"time"
+)
+
+// Parses an optional RFC3339 time flag.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// Tells a printable form of an error.
+func describe(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	return err.Error()
+}
+
+// Tells the identifier of a replayed credential.
+func identify(credential credentials.Credential) interface{} {
+	if replayed, ok := credential.(*replay.Credential); ok {
+		return replayed.Identification()
+	}
+	return nil
+}
+
+// Loads a recording, filters it and replays it into a fresh auth
+// protocol whose listeners print each replayed event. Tells the
+// exit status.
+func run(arguments []string, output, errorOutput io.Writer) int {
+	flags := flag.NewFlagSet("authreplay", flag.ContinueOnError)
+	flags.SetOutput(errorOutput)
+	file := flags.String("file", "", "The recording to replay (required)")
+	identifier := flags.String("identifier", "", "Keep only the events of this identifier")
+	realm := flags.String("realm", "", "Keep only the events of sessions logged in this realm")
+	since := flags.String("since", "", "Keep only the events recorded at or after this RFC3339 time")
+	until := flags.String("until", "", "Keep only the events recorded before this RFC3339 time")
+	outcome := flags.String("outcome", "", "Keep only the events with this outcome: success or failure")
+	if err := flags.Parse(arguments); err != nil {
+		return 2
+	}
+
+	if *file == "" {
+		flags.Usage()
+		return 2
+	}
+	if *outcome != "" && *outcome != "success" && *outcome != "failure" {
+		fmt.Fprintf(errorOutput, "Invalid -outcome: %s\n", *outcome)
+		return 2
+	}
+	filter := replay.Filter{RealmKey: *realm, Outcome: *outcome}
+	var err error
+	if filter.Since, err = parseTime(*since); err != nil {
+		fmt.Fprintf(errorOutput, "Invalid -since time (expected RFC3339): %s\n", err)
+		return 2
+	}
+	if filter.Until, err = parseTime(*until); err != nil {
+		fmt.Fprintf(errorOutput, "Invalid -until time (expected RFC3339): %s\n", err)
+		return 2
+	}
+	if *identifier != "" {
+		filter.Identifier = *identifier
+	}
+
+	reader, err := os.Open(*file)
+	if err != nil {
+		fmt.Fprintf(errorOutput, "Could not open the recording: %s\n", err)
+		return 1
+	}
+	entries, err := replay.Load(reader)
+	_ = reader.Close()
+	if err != nil {
+		fmt.Fprintf(errorOutput, "Could not load the recording: %s\n", err)
+		return 1
+	}
+	entries = filter.Apply(entries)
+
+	protocol := auth.NewAuthProtocol(map[string]*realms.Realm{})
+	protocol.OnLogin().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, identifier interface{}, password, realm string, credential credentials.Credential, err error) {
+		fmt.Fprintf(output, "login %v@%s: %s\n", identifier, realm, describe(err))
+	})
+	protocol.OnLogout().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, kind events.LogoutKind, reason string, stage events.LogoutStage) {
+		if stage == events.After {
+			fmt.Fprintf(output, "logout %v: %s %s\n", identify(credential), kind, reason)
+		}
+	})
+	protocol.OnPasswordChange().Register(func(server *chasqui.Server, attendant *chasqui.Attendant, credential credentials.Credential, err error) {
+		fmt.Fprintf(output, "password-change %v: %s\n", identify(credential), describe(err))
+	})
+
+	replay.NewReplayer(protocol, nil, nil).ReplayAll(entries)
+	fmt.Fprintf(output, "Replayed %d events\n", len(entries))
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
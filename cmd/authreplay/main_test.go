@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const recording = `{"timestamp":"2020-01-01T00:00:00Z","event":"login","attendant":"1","realm_key":"main","identifier":"alice"}
+{"timestamp":"2020-01-01T00:01:00Z","event":"login","attendant":"2","realm_key":"other","identifier":"bob","error":"login failed"}
+{"timestamp":"2020-01-01T00:02:00Z","event":"logout","attendant":"1","identifier":"alice","kind":"graceful","stage":"after"}
+`
+
+// Writes the recording to a temporary file, removed after
+// the test.
+func recordingFile(t *testing.T) string {
+	directory, err := ioutil.TempDir("", "authreplay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(directory)
+	})
+	path := filepath.Join(directory, "recording.jsonl")
+	if err := ioutil.WriteFile(path, []byte(recording), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunReplaysTheFilteredRecording(t *testing.T) {
+	path := recordingFile(t)
+	for _, test := range []struct {
+		arguments []string
+		expected  string
+	}{
+		{nil, "login alice@main: ok\nlogin bob@other: login failed\nlogout alice: graceful \nReplayed 3 events\n"},
+		{[]string{"-realm", "main"}, "login alice@main: ok\nlogout alice: graceful \nReplayed 2 events\n"},
+		{[]string{"-outcome", "failure"}, "login bob@other: login failed\nReplayed 1 events\n"},
+		{[]string{"-since", "2020-01-01T00:01:00Z"}, "login bob@other: login failed\nlogout alice: graceful \nReplayed 2 events\n"},
+	} {
+		output, errorOutput := &bytes.Buffer{}, &bytes.Buffer{}
+		if status := run(append([]string{"-file", path}, test.arguments...), output, errorOutput); status != 0 {
+			t.Fatalf("%v: unexpected status %d: %s", test.arguments, status, errorOutput)
+		}
+		if output.String() != test.expected {
+			t.Errorf("%v: expected %q, got %q", test.arguments, test.expected, output.String())
+		}
+	}
+}
+
+func TestRunRejectsInvalidArguments(t *testing.T) {
+	path := recordingFile(t)
+	for _, test := range []struct {
+		arguments []string
+		status    int
+		message   string
+	}{
+		{nil, 2, "-file"},
+		{[]string{"-file", path, "-outcome", "maybe"}, 2, "Invalid -outcome"},
+		{[]string{"-file", path, "-until", "yesterday"}, 2, "Invalid -until"},
+		{[]string{"-file", path + ".missing"}, 1, "Could not open the recording"},
+	} {
+		errorOutput := &bytes.Buffer{}
+		if status := run(test.arguments, ioutil.Discard, errorOutput); status != test.status {
+			t.Errorf("%v: expected status %d, got %d", test.arguments, test.status, status)
+		}
+		if !strings.Contains(errorOutput.String(), test.message) {
+			t.Errorf("%v: expected %q in %q", test.arguments, test.message, errorOutput.String())
+		}
+	}
+}
@@ -6,4 +6,5 @@ require (
 	github.com/universe-10th/chasqui v0.0.5
 	github.com/universe-10th/chasqui-protocols v0.0.1
 	github.com/universe-10th/identity v0.1.2
+	gopkg.in/yaml.v2 v2.4.0
 )